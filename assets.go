@@ -0,0 +1,232 @@
+package orbit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// AssetOptions configures Assets.
+type AssetOptions struct {
+	// Prefix is the path Assets is mounted on, e.g. "/assets", which
+	// starts the URLs it builds.
+	Prefix string
+
+	// HashLength is the number of hex digits of the content hash in the
+	// file names. Defaults to 8.
+	HashLength int
+
+	// RedirectStale redirects requests for a previous hash of a file to
+	// its current one, for pages cached before a release. They get a 404
+	// otherwise.
+	RedirectStale bool
+
+	// Static configures the serving of the files. Fingerprinted is
+	// ignored, the files requested by their hashed name are always cached
+	// forever.
+	Static StaticOptions
+}
+
+// Assets serves the files of an fs.FS under names holding a hash of their
+// content, e.g. "app.3f9a1c0b.js" for "app.js", so they can be cached
+// forever and still be updated by a release. Mount it on the prefix of the
+// options:
+//
+//	assets, err := orbit.NewAssets(dist, orbit.AssetOptions{Prefix: "/assets"})
+//	o.Mount("/assets", assets)
+//
+// Files are still served by their original name, with the Cache-Control of
+// the static options.
+type Assets struct {
+	opts   AssetOptions
+	urls   map[string]string // name -> URL
+	hashed map[string]string // hashed name -> name
+	stale  *regexp.Regexp
+	files  *fileServer
+	plain  *fileServer
+}
+
+// NewAssets scans `fsys` and hashes the content of its files. Precompressed
+// .br and .gz siblings are served with their file and aren't hashed.
+func NewAssets(fsys fs.FS, opts AssetOptions) (*Assets, error) {
+	if opts.HashLength <= 0 {
+		opts.HashLength = 8
+	}
+	if opts.HashLength > sha256.Size*2 {
+		opts.HashLength = sha256.Size * 2
+	}
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+
+	static := opts.Static
+	static.Fingerprinted = func(string) bool { return true }
+	a := &Assets{
+		opts:   opts,
+		urls:   map[string]string{},
+		hashed: map[string]string{},
+		stale:  regexp.MustCompile(fmt.Sprintf(`^(.*)\.[0-9a-f]{%d}(\.[^.]+)?$`, opts.HashLength)),
+		files:  newFileServer(fsys, static),
+		plain:  newFileServer(fsys, opts.Static),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !opts.Static.DotFiles && name != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || isPrecompressed(fsys, name) {
+			return nil
+		}
+
+		hash, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		h := hashedName(name, hash[:opts.HashLength])
+		a.hashed[h] = name
+		a.urls[name] = opts.Prefix + "/" + h
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("orbit: scanning assets: %w", err)
+	}
+	return a, nil
+}
+
+// URL returns the URL of the current version of the file `name`, e.g.
+// "/assets/app.3f9a1c0b.js" for "app.js". Unknown files get their URL
+// without hash.
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if u, ok := a.urls[name]; ok {
+		return u
+	}
+	return a.opts.Prefix + "/" + name
+}
+
+// FuncMap returns the "asset" template function, turning a file name into
+// its URL:
+//
+//	<script src="{{asset "app.js"}}"></script>
+//
+// It fails the template for unknown files, to catch typos.
+func (a *Assets) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"asset": func(name string) (string, error) {
+			u, ok := a.urls[strings.TrimPrefix(name, "/")]
+			if !ok {
+				return "", fmt.Errorf("orbit: unknown asset '%s'", name)
+			}
+			return u, nil
+		},
+	}
+}
+
+// Manifest returns the URL of every file, by file name.
+func (a *Assets) Manifest() map[string]string {
+	m := make(map[string]string, len(a.urls))
+	for name, u := range a.urls {
+		m[name] = u
+	}
+	return m
+}
+
+// ManifestHandler returns a handler serving the manifest as JSON, for
+// frontends and tools building URLs on their own.
+func (a *Assets) ManifestHandler() HandlerFunc {
+	return func(b Bits) error {
+		b.Response().Header().Set("Content-Type", "application/json")
+		b.Response().Header().Set("Cache-Control", "no-cache")
+		return json.NewEncoder(b.Response()).Encode(a.urls)
+	}
+}
+
+// ServeHTTP serves the file requested by its hashed or original name.
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	HandlerFunc(a.serve).ServeHTTP(w, r)
+}
+
+func (a *Assets) serve(b Bits) error {
+	r := b.Request()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		e := NewHTTPError(http.StatusMethodNotAllowed)
+		e.Header = http.Header{"Allow": {"GET, HEAD"}}
+		return e
+	}
+
+	raw := requestPath(r)
+	if rctx := RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		raw = rctx.RoutePath
+	}
+	p := strings.TrimPrefix(raw, "/")
+	if r.URL.RawPath != "" {
+		var err error
+		if p, err = url.PathUnescape(p); err != nil {
+			return errNotFound()
+		}
+	}
+
+	if name, ok := a.hashed[p]; ok {
+		info, err := fs.Stat(a.files.fsys, name)
+		if err != nil {
+			return errNotFound()
+		}
+		return a.files.serveFile(b.Response(), r, name, info)
+	}
+
+	if m := a.stale.FindStringSubmatch(p); m != nil && a.opts.RedirectStale {
+		if u, ok := a.urls[m[1]+m[2]]; ok {
+			b.Response().Header().Set("Cache-Control", "no-cache")
+			http.Redirect(b.Response(), r, u, http.StatusFound)
+			return nil
+		}
+	}
+	return a.plain.serveName(b, raw)
+}
+
+// hashedName inserts `hash` before the extension of `name`.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		ext = ""
+	}
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// isPrecompressed reports whether `name` is the .br or .gz sibling of
+// another file.
+func isPrecompressed(fsys fs.FS, name string) bool {
+	ext := path.Ext(name)
+	if ext != ".br" && ext != ".gz" {
+		return false
+	}
+	info, err := fs.Stat(fsys, strings.TrimSuffix(name, ext))
+	return err == nil && !info.IsDir()
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
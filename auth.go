@@ -0,0 +1,224 @@
+package orbit
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// PrincipalCtxKey is the context.Context key to store the authenticated
+	// principal of a request.
+	PrincipalCtxKey = &contextKey{"Principal"}
+)
+
+// Principal is the authenticated identity behind a request, as put on the
+// request context by the BasicAuth, APIKey and JWT middlewares.
+type Principal struct {
+	// Subject identifies the user or client, e.g. a username or the
+	// `sub` claim of a token.
+	Subject string
+
+	// Scheme is the authentication scheme that produced the principal:
+	// "basic", "apikey" or "jwt".
+	Scheme string
+
+	// Roles and Scopes are used by authorization checks.
+	Roles  []string
+	Scopes []string
+
+	// Claims holds any additional attributes, such as the full set of
+	// token claims for JWT.
+	Claims map[string]interface{}
+}
+
+// HasRole reports whether the principal has the role `role`.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && contains(p.Roles, role)
+}
+
+// HasScope reports whether the principal was granted the scope `scope`.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && contains(p.Scopes, scope)
+}
+
+// PrincipalContext returns the authenticated principal from a http.Request
+// Context, or nil for anonymous requests.
+func PrincipalContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(PrincipalCtxKey).(*Principal)
+	return p
+}
+
+// WithPrincipal returns a copy of `ctx` carrying the principal `p`. It's
+// useful to write custom authentication middlewares.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, PrincipalCtxKey, p)
+}
+
+// SecureCompare compares two secrets in constant time.
+func SecureCompare(given, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(actual)) == 1
+}
+
+// BasicAuth returns a middleware implementing HTTP Basic authentication.
+// `validate` is called with the supplied credentials and must compare the
+// password with SecureCompare, or an equivalent constant time check,
+// returning nil for invalid credentials.
+func BasicAuth(realm string, validate func(user, pass string) *Principal) func(Handler) Handler {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok {
+				Error(w, r, unauthorized(challenge, nil))
+				return
+			}
+			p := validate(user, pass)
+			if p == nil {
+				Error(w, r, unauthorized(challenge, errors.New("invalid credentials")))
+				return
+			}
+			// The validator may hand out shared principals.
+			cp := *p
+			if cp.Subject == "" {
+				cp.Subject = user
+			}
+			cp.Scheme = "basic"
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), &cp)))
+		})
+	}
+}
+
+// BasicAuthUsers returns a BasicAuth validator for a static set of
+// username/password pairs.
+func BasicAuthUsers(users map[string]string) func(user, pass string) *Principal {
+	return func(user, pass string) *Principal {
+		actual, ok := users[user]
+		// Compare even for unknown users so timing doesn't reveal them.
+		if !SecureCompare(pass, actual) || !ok {
+			return nil
+		}
+		return &Principal{Subject: user}
+	}
+}
+
+// APIKeyOptions configures the APIKey middleware.
+type APIKeyOptions struct {
+	// Realm is advertised in the WWW-Authenticate challenge.
+	Realm string
+
+	// Header is the request header carrying the key. Defaults to
+	// "X-API-Key" unless Query or Bearer is set.
+	Header string
+
+	// Query is an optional URL query parameter carrying the key.
+	Query string
+
+	// Bearer also accepts the key as an "Authorization: Bearer" token.
+	Bearer bool
+
+	// Keys maps static keys to their principal.
+	Keys map[string]*Principal
+
+	// Validate is consulted for keys not found in Keys. It returns nil
+	// for unknown keys.
+	Validate func(r *http.Request, key string) (*Principal, error)
+}
+
+// APIKey returns a middleware that authenticates requests by a static or
+// callback validated API key.
+func APIKey(opts APIKeyOptions) func(Handler) Handler {
+	if opts.Keys == nil && opts.Validate == nil {
+		panic("orbit: APIKey requires Keys or a Validate callback")
+	}
+	if opts.Header == "" && opts.Query == "" && !opts.Bearer {
+		opts.Header = "X-API-Key"
+	}
+
+	scheme := "APIKey"
+	if opts.Bearer {
+		scheme = "Bearer"
+	}
+	challenge := fmt.Sprintf("%s realm=%q", scheme, opts.Realm)
+
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := apiKeyFromRequest(r, opts)
+			if key == "" {
+				Error(w, r, unauthorized(challenge, nil))
+				return
+			}
+
+			var p *Principal
+			// Check every static key so timing doesn't leak which one matched.
+			for k, kp := range opts.Keys {
+				if SecureCompare(key, k) {
+					p = kp
+				}
+			}
+			if p == nil && opts.Validate != nil {
+				var err error
+				if p, err = opts.Validate(r, key); err != nil {
+					Error(w, r, err)
+					return
+				}
+			}
+			if p == nil {
+				Error(w, r, unauthorized(challenge, errors.New("invalid api key")))
+				return
+			}
+
+			// Principals in Keys are shared across requests, so hand out a copy.
+			cp := *p
+			cp.Scheme = "apikey"
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), &cp)))
+		})
+	}
+}
+
+func apiKeyFromRequest(r *http.Request, opts APIKeyOptions) string {
+	if opts.Header != "" {
+		if key := r.Header.Get(opts.Header); key != "" {
+			return key
+		}
+	}
+	if opts.Bearer {
+		if key := bearerToken(r); key != "" {
+			return key
+		}
+	}
+	if opts.Query != "" {
+		return r.URL.Query().Get(opts.Query)
+	}
+	return ""
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// unauthorized returns a 401 HTTPError with the WWW-Authenticate challenge.
+func unauthorized(challenge string, cause error) *HTTPError {
+	e := NewHTTPError(http.StatusUnauthorized)
+	e.Header = http.Header{"Www-Authenticate": {challenge}}
+	e.Err = cause
+	return e
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package orbit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Policy is a named authorization rule evaluated against the authenticated
+// Principal of a request. The name is what shows up in permission reports.
+type Policy struct {
+	Name  string
+	Check func(r *http.Request, p *Principal) bool
+}
+
+// PolicyFunc returns a Policy from a plain function.
+func PolicyFunc(name string, check func(r *http.Request, p *Principal) bool) Policy {
+	return Policy{Name: name, Check: check}
+}
+
+// Scope requires the principal to have been granted `scope`.
+func Scope(scope string) Policy {
+	return Policy{Name: scope, Check: func(_ *http.Request, p *Principal) bool {
+		return p.HasScope(scope)
+	}}
+}
+
+// Role requires the principal to have `role`.
+func Role(role string) Policy {
+	return Policy{Name: "role:" + role, Check: func(_ *http.Request, p *Principal) bool {
+		return p.HasRole(role)
+	}}
+}
+
+// Owner requires the URL parameter `param` to equal the principal subject,
+// e.g. Owner("userID") on "/users/{userID}/orders".
+func Owner(param string) Policy {
+	return Policy{Name: "owner:{" + param + "}", Check: func(r *http.Request, p *Principal) bool {
+		v := URLParam(r, param)
+		return v != "" && v == p.Subject
+	}}
+}
+
+// AllOf requires every one of `policies` to pass.
+func AllOf(policies ...Policy) Policy {
+	return Policy{Name: joinPolicyNames(policies, " and "), Check: func(r *http.Request, p *Principal) bool {
+		for _, pol := range policies {
+			if !pol.Check(r, p) {
+				return false
+			}
+		}
+		return true
+	}}
+}
+
+// AnyOf requires at least one of `policies` to pass.
+func AnyOf(policies ...Policy) Policy {
+	return Policy{Name: joinPolicyNames(policies, " or "), Check: func(r *http.Request, p *Principal) bool {
+		for _, pol := range policies {
+			if pol.Check(r, p) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+func joinPolicyNames(policies []Policy, sep string) string {
+	names := make([]string, len(policies))
+	for i, pol := range policies {
+		names[i] = pol.Name
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return "(" + strings.Join(names, sep) + ")"
+}
+
+// Require returns a middleware that requires the principal to have been
+// granted every scope in `permissions`, e.g.
+//
+//	r.With(orbit.Require("orders:write")).Post("/orders", createOrder)
+func Require(permissions ...string) func(Handler) Handler {
+	policies := make([]Policy, len(permissions))
+	for i, perm := range permissions {
+		policies[i] = Scope(perm)
+	}
+	return Authorize(policies...)
+}
+
+// Authorize returns a middleware that requires every policy to pass.
+// Anonymous requests get a 401 and authenticated requests that fail a
+// policy get a 403, both through the router error handler.
+func Authorize(policies ...Policy) func(Handler) Handler {
+	return func(next Handler) Handler {
+		return &authorizer{policies: policies, next: next}
+	}
+}
+
+type authorizer struct {
+	policies []Policy
+	next     Handler
+}
+
+func (a *authorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if authorize(w, r, a.policies) {
+		a.next.ServeHTTP(w, r)
+	}
+}
+
+// routeGuard checks the policies declared on a route with
+// RouteHandle.Authorize before its handler.
+type routeGuard struct {
+	meta *RouteMeta
+	next Handler
+}
+
+func (g *routeGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(g.meta.Policies) == 0 || authorize(w, r, g.meta.Policies) {
+		g.next.ServeHTTP(w, r)
+	}
+}
+
+// authorize checks `policies` against the principal of `r`, and reports
+// whether they all pass. Otherwise, it responds with a 401 or a 403.
+func authorize(w http.ResponseWriter, r *http.Request, policies []Policy) bool {
+	p := PrincipalContext(r.Context())
+	if p == nil {
+		Error(w, r, NewHTTPError(http.StatusUnauthorized))
+		return false
+	}
+	for _, pol := range policies {
+		if !pol.Check(r, p) {
+			e := NewHTTPError(http.StatusForbidden)
+			e.Err = fmt.Errorf("policy %s denied %q", pol.Name, p.Subject)
+			Error(w, r, e)
+			return false
+		}
+	}
+	return true
+}
+
+// RouteAccess describes the policies guarding a route, as reported by
+// PermissionReport.
+type RouteAccess struct {
+	Method   string
+	Route    string
+	Policies []string
+}
+
+// PermissionReport walks `r` and lists the authorization policies that each
+// route requires, sorted by route and method. Routes without any policy are
+// included with an empty list so they stand out in an audit. The policies
+// are the ones the routers recorded while building their middleware
+// chains, the middlewares aren't called again, followed by the ones
+// declared on the routes.
+func PermissionReport(r Routes) ([]RouteAccess, error) {
+	var report []RouteAccess
+	err := WalkRoutes(r, func(ri RouteInfo) error {
+		report = append(report, RouteAccess{Method: ri.Method, Route: ri.Route, Policies: ri.Policies})
+		return nil
+	})
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Route != report[j].Route {
+			return report[i].Route < report[j].Route
+		}
+		return report[i].Method < report[j].Method
+	})
+	return report, err
+}
+
+// appendPolicyNames appends the names of `policies` to `names`.
+func appendPolicyNames(names []string, policies []Policy) []string {
+	for _, pol := range policies {
+		names = append(names, pol.Name)
+	}
+	return names
+}
+
+// WritePermissionReport writes PermissionReport as an aligned text table.
+func WritePermissionReport(w io.Writer, r Routes) error {
+	report, err := PermissionReport(r)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tROUTE\tREQUIRES")
+	for _, ra := range report {
+		requires := "-"
+		if len(ra.Policies) > 0 {
+			requires = strings.Join(ra.Policies, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", ra.Method, ra.Route, requires)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,142 @@
+package orbit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// authenticate is a middleware authenticating every request as `p`, or
+// leaving it anonymous if nil.
+func authenticate(p *Principal) func(Handler) Handler {
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), p))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	alice := &Principal{Subject: "alice", Roles: []string{"admin"}, Scopes: []string{"orders:read"}}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   bool
+	}{
+		{"Scope", Scope("orders:read"), true},
+		{"MissingScope", Scope("orders:write"), false},
+		{"Role", Role("admin"), true},
+		{"MissingRole", Role("auditor"), false},
+		{"Owner", Owner("user"), true},
+		{"OtherOwner", Owner("other"), false},
+		{"AllOf", AllOf(Role("admin"), Scope("orders:read")), true},
+		{"AllOfMissing", AllOf(Role("admin"), Scope("orders:write")), false},
+		{"AnyOf", AnyOf(Role("auditor"), Scope("orders:read")), true},
+		{"AnyOfMissing", AnyOf(Role("auditor"), Scope("orders:write")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOrbit()
+			o.Use(authenticate(alice))
+			o.With(Authorize(tt.policy)).Get("/users/{user}/orders/{other}", func(b Bits) error { return nil })
+
+			w := httptest.NewRecorder()
+			o.ServeHTTP(w, httptest.NewRequest("GET", "/users/alice/orders/bob", nil))
+			if got := w.Code == http.StatusOK; got != tt.want {
+				t.Errorf("%s allowed = %v (%d), want %v", tt.policy.Name, got, w.Code, tt.want)
+			}
+			if !tt.want && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+
+	if name := AllOf(Role("admin"), AnyOf(Scope("a"), Scope("b"))).Name; name != "(role:admin and (a or b))" {
+		t.Errorf("name = %q", name)
+	}
+}
+
+// Policies declared on a route are checked after its middlewares, which
+// may authenticate the request.
+func TestRouteAuthorize(t *testing.T) {
+	o := NewOrbit()
+	h := func(b Bits) error { return nil }
+	o.With(authenticate(&Principal{Subject: "alice", Scopes: []string{"orders:read"}})).Group(func(r Router) {
+		r.Get("/orders", h).Require("orders:read")
+		r.Post("/orders", h).Require("orders:write")
+	})
+	o.With(authenticate(nil)).Get("/anonymous", h).Authorize(Role("admin"))
+	o.Get("/public", h)
+
+	for _, tt := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/orders", http.StatusOK},
+		{"POST", "/orders", http.StatusForbidden},
+		{"GET", "/anonymous", http.StatusUnauthorized},
+		{"GET", "/public", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+	}
+}
+
+func TestPermissionReport(t *testing.T) {
+	calls := 0
+	counted := func(next Handler) Handler {
+		calls++
+		return http.HandlerFunc(next.ServeHTTP)
+	}
+	h := func(b Bits) error { return nil }
+
+	api := NewOrbit()
+	api.Use(counted, Require("api"))
+	api.With(counted, Require("orders:write")).Post("/orders", h).Authorize(Owner("id"))
+	api.Get("/orders", h)
+
+	o := NewOrbit()
+	o.Get("/health", h)
+	o.Mount("/api", api)
+
+	v := NewVersions(VersionOptions{Path: true})
+	v.Version("1", api)
+
+	built := calls
+	report, err := PermissionReport(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RouteAccess{
+		{"GET", "/api/orders", []string{"api"}},
+		{"POST", "/api/orders", []string{"api", "orders:write", "owner:{id}"}},
+		{"GET", "/health", nil},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %v, want %v", report, want)
+	}
+
+	report, err = PermissionReport(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []RouteAccess{
+		{"GET", "/v1/orders", []string{"api"}},
+		{"POST", "/v1/orders", []string{"api", "orders:write", "owner:{id}"}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("versions report = %v, want %v", report, want)
+	}
+
+	if calls != built {
+		t.Errorf("reports built middlewares %d times", calls-built)
+	}
+}
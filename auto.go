@@ -0,0 +1,147 @@
+package orbit
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AutoHead makes routes registered for GET answer HEAD requests too,
+// unless a HEAD handler is registered for them. The GET handler runs with
+// its body discarded, and the response keeps the Content-Length of the
+// body it would have sent. The request goes through the middlewares of the
+// GET route, inline ones included. It applies to the mounted sub-routers as
+// well.
+func (o *Orbit) AutoHead(enabled bool) {
+	m := o.owner()
+	m.autoHead = enabled
+	m.updateSubRoutes(func(subMux *Orbit) {
+		subMux.AutoHead(enabled)
+	})
+}
+
+// AutoOptions makes routes answer OPTIONS requests with a 204 and an Allow
+// header listing the methods registered for them, unless an OPTIONS
+// handler is registered for them. The answer comes from the routing tree,
+// so only the middlewares of the router run, not those added with With or
+// Group for a route: middlewares OPTIONS needs, such as CORS, belong in
+// Use. It applies to the mounted sub-routers as well.
+func (o *Orbit) AutoOptions(enabled bool) {
+	m := o.owner()
+	m.autoOptions = enabled
+	m.updateSubRoutes(func(subMux *Orbit) {
+		subMux.AutoOptions(enabled)
+	})
+}
+
+// autoMethod serves HEAD and OPTIONS requests for a route that doesn't
+// handle them, if enabled. It reports whether the request was served.
+func (o *Orbit) autoMethod(w http.ResponseWriter, r *http.Request, rctx *Context, method methodTyp, routePath string) bool {
+	switch {
+	case method == mHEAD && o.autoHead && allows(rctx.methodsAllowed, mGET):
+		_, _, h := o.root().FindRoute(rctx, mGET, routePath)
+		if h == nil {
+			return false
+		}
+		hw := &headWriter{ResponseWriter: w}
+		h.ServeHTTP(hw, r)
+		hw.commit()
+		return true
+
+	case method == mOPTIONS && o.autoOptions:
+		methods := rctx.methodsAllowed
+		if o.autoHead && allows(methods, mGET) {
+			methods = append(methods[:len(methods):len(methods)], mHEAD)
+		}
+		w.Header().Set("Allow", allowHeader(append(methods[:len(methods):len(methods)], mOPTIONS)))
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	return false
+}
+
+func allows(methods []methodTyp, method methodTyp) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeader returns the sorted, unique names of `methods`.
+func allowHeader(methods []methodTyp) string {
+	var names []string
+	for _, m := range methods {
+		if name := methodTypString(m); name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// headWriter discards the body written by a GET handler serving a HEAD
+// request. It holds the header back until the handler is done, to set the
+// Content-Length of the discarded body.
+type headWriter struct {
+	http.ResponseWriter
+	status    int
+	written   int64
+	committed bool
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.written += int64(len(p))
+	return len(p), nil
+}
+
+// Flush commits the header as is, the Content-Length is unknown at this
+// point.
+func (hw *headWriter) Flush() {
+	hw.commit()
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (hw *headWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("orbit: response writer does not support hijacking")
+	}
+	hw.committed = true
+	return hj.Hijack()
+}
+
+func (hw *headWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+func (hw *headWriter) commit() {
+	if hw.committed {
+		return
+	}
+	hw.committed = true
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hdr := hw.ResponseWriter.Header()
+	if hdr.Get("Content-Length") == "" && hdr.Get("Transfer-Encoding") == "" && hw.written > 0 {
+		hdr.Set("Content-Length", strconv.FormatInt(hw.written, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
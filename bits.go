@@ -1,17 +1,50 @@
 package orbit
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
 
+// Bits is what a HandlerFunc gets to serve a request. It is pooled and
+// reused once the handler returns, so don't keep it, e.g. in a goroutine
+// started by the handler; copy the values needed out of it instead.
 type Bits interface {
 	Response() http.ResponseWriter
 	Request() *http.Request
 	Text(code int, s string) error
+
+	// Cookie returns the named cookie from the request.
+	Cookie(name string) (*http.Cookie, error)
+	// SetCookie writes a cookie with HttpOnly, Secure and SameSite=Lax
+	// defaults, adjusted by `opts`.
+	SetCookie(name, value string, opts ...CookieOption)
+	// ClearCookie tells the client to drop the named cookie.
+	ClearCookie(name string, opts ...CookieOption)
+
+	// Session returns the request session loaded by the Session
+	// middleware, or nil if the middleware isn't in use.
+	Session() *SessionState
+
+	// Principal returns the authenticated principal of the request, or
+	// nil for anonymous requests.
+	Principal() *Principal
+
+	// URLFor builds the path of a named route, see Orbit.URL.
+	URLFor(name string, params ...string) (string, error)
+
+	// SSE opens a stream of server-sent events on the response. The
+	// stream is closed when the handler returns, and an error returned
+	// by the handler goes to SSEOnError, as the response is already
+	// under way.
+	SSE(opts ...SSEOption) (*SSEStream, error)
 }
 
 type bits struct {
 	response http.ResponseWriter
 	request  *http.Request
 	name     string
+	sse      *SSEStream
 }
 
 func (b *bits) Response() http.ResponseWriter {
@@ -22,6 +55,38 @@ func (b *bits) Request() *http.Request {
 	return b.request
 }
 
+func (b *bits) Cookie(name string) (*http.Cookie, error) {
+	return b.request.Cookie(name)
+}
+
+func (b *bits) SetCookie(name, value string, opts ...CookieOption) {
+	http.SetCookie(b.response, newCookie(name, value, opts))
+}
+
+func (b *bits) ClearCookie(name string, opts ...CookieOption) {
+	c := newCookie(name, "", opts)
+	c.MaxAge = -1
+	c.Expires = time.Unix(0, 0)
+	http.SetCookie(b.response, c)
+}
+
+func (b *bits) Session() *SessionState {
+	return SessionContext(b.request.Context())
+}
+
+func (b *bits) Principal() *Principal {
+	return PrincipalContext(b.request.Context())
+}
+
+func (b *bits) URLFor(name string, params ...string) (string, error) {
+	if rctx := RouteContext(b.request.Context()); rctx != nil {
+		if o, ok := rctx.Routes.(*Orbit); ok {
+			return o.URL(name, params...)
+		}
+	}
+	return "", fmt.Errorf("orbit: no router to resolve route '%s'", name)
+}
+
 func (b *bits) Text(code int, s string) error {
 	b.response.Header().Set("Content-Type", "text/plain")
 	b.response.WriteHeader(code)
@@ -10,13 +10,21 @@ func Chain(middlewares ...func(Handler) Handler) Middlewares {
 // Handler builds and returns a Handler from the chain of middlewares,
 // with `h Handler` as the final handler.
 func (mws Middlewares) Handler(h Handler) Handler {
-	return &ChainHandler{h, chain(mws, h), mws}
+	c := &ChainHandler{Endpoint: h, Middlewares: mws}
+	var policies []Policy
+	c.chain, policies = chain(mws, h)
+	c.policies = appendPolicyNames(nil, policies)
+	return c
 }
 
 // HandlerFunc builds and returns a Handler from the chain of middlewares,
 // with `h Handler` as the final handler.
 func (mws Middlewares) HandlerFunc(h HandlerFunc) Handler {
-	return &ChainHandler{h, chain(mws, h), mws}
+	c := &ChainHandler{Endpoint: h, Middlewares: mws}
+	var policies []Policy
+	c.chain, policies = chain(mws, h)
+	c.policies = appendPolicyNames(nil, policies)
+	return c
 }
 
 // ChainHandler is a Handler with support for handler composition and
@@ -25,6 +33,9 @@ type ChainHandler struct {
 	Endpoint    Handler
 	chain       Handler
 	Middlewares Middlewares
+
+	// names of the policies of the Authorize middlewares of the chain
+	policies []string
 }
 
 func (c *ChainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -32,18 +43,23 @@ func (c *ChainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // chain builds a Handler composed of an inline middleware stack and endpoint
-// handler in the order they are passed.
-func chain(middlewares []func(Handler) Handler, endpoint Handler) Handler {
+// handler in the order they are passed. It also returns the policies of the
+// Authorize middlewares of the stack, in the order they are checked.
+func chain(middlewares []func(Handler) Handler, endpoint Handler) (Handler, []Policy) {
 	// Return ahead of time if there aren't any middlewares for the chain
 	if len(middlewares) == 0 {
-		return endpoint
+		return endpoint, nil
 	}
 
 	// Wrap the end handler with the middleware chain
-	h := middlewares[len(middlewares)-1](endpoint)
-	for i := len(middlewares) - 2; i >= 0; i-- {
+	var policies []Policy
+	h := endpoint
+	for i := len(middlewares) - 1; i >= 0; i-- {
 		h = middlewares[i](h)
+		if a, ok := h.(*authorizer); ok {
+			policies = append(a.policies[:len(a.policies):len(a.policies)], policies...)
+		}
 	}
 
-	return h
+	return h, policies
 }
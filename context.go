@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 // URLParam returns the url parameter from a http.Request object.
@@ -25,6 +26,9 @@ func URLParamFromCtx(ctx context.Context, key string) string {
 // RouteContext returns chi's routing Context object from a
 // http.Request Context.
 func RouteContext(ctx context.Context) *Context {
+	if rc, ok := ctx.(*requestContext); ok {
+		return rc.rctx.Load()
+	}
 	val, _ := ctx.Value(RouteCtxKey).(*Context)
 	return val
 }
@@ -42,14 +46,14 @@ var (
 // Context is the default routing context set on the root node of a
 // request context to track route patterns, URL parameters and
 // an optional routing path.
+//
+// Context is pooled and reused once the request is served. The request
+// context lets go of it then: a request context kept past the handler,
+// e.g. by a goroutine it starts, keeps its cancellation and values, but
+// RouteContext returns nil for it.
 type Context struct {
 	Routes Routes
 
-	// parentCtx is the parent of this one, for using Context as a
-	// context.Context directly. This is an optimization that saves
-	// 1 allocation.
-	parentCtx context.Context
-
 	// Routing path/method override used during the route search.
 	// See Mux#routeHTTP method.
 	RoutePath   string
@@ -74,9 +78,20 @@ type Context struct {
 	// patterns across a stack of sub-routers.
 	RoutePatterns []string
 
+	// Metadata of the endpoint that matched in the current sub-router.
+	routeMeta *RouteMeta
+
 	// methodNotAllowed hint
 	methodNotAllowed bool
 	methodsAllowed   []methodTyp // allowed methods in case of a 405
+
+	// foldCase matches static segments regardless of case
+	foldCase bool
+
+	// matchRequest is the request Match is resolving, for routers
+	// routing on its headers. It is nil when matching a bare method and
+	// path.
+	matchRequest *http.Request
 }
 
 // Reset a routing context to its initial state.
@@ -89,10 +104,48 @@ func (x *Context) Reset() {
 	x.URLParams.Values = x.URLParams.Values[:0]
 
 	x.routePattern = ""
+	x.routeMeta = nil
 	x.routeParams.Keys = x.routeParams.Keys[:0]
 	x.routeParams.Values = x.routeParams.Values[:0]
 	x.methodNotAllowed = false
-	x.parentCtx = nil
+	x.methodsAllowed = x.methodsAllowed[:0]
+	x.foldCase = false
+	x.matchRequest = nil
+}
+
+// requestContext is the context.Context of a request routed by Orbit,
+// Hosts or Versions, carrying the routing context. It is allocated for
+// every request, unlike the routing context, which it drops once the
+// request is served so that it is never seen by a later request.
+type requestContext struct {
+	context.Context
+	rctx atomic.Pointer[Context]
+}
+
+// withRouteContext returns `r` with a request context carrying `rctx`.
+// The request context must be released before `rctx` goes back to its
+// pool.
+func withRouteContext(r *http.Request, rctx *Context) (*http.Request, *requestContext) {
+	rc := &requestContext{Context: r.Context()}
+	rc.rctx.Store(rctx)
+	return r.WithContext(rc), rc
+}
+
+// Value returns the routing context for RouteCtxKey, until the request is
+// served, and the value of the parent context for any other key.
+func (c *requestContext) Value(key interface{}) interface{} {
+	if key == RouteCtxKey {
+		if rctx := c.rctx.Load(); rctx != nil {
+			return rctx
+		}
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// release drops the routing context once the request is served.
+func (c *requestContext) release() {
+	c.rctx.Store(nil)
 }
 
 // URLParam returns the corresponding URL parameter value from the request
@@ -106,6 +159,13 @@ func (x *Context) URLParam(key string) string {
 	return ""
 }
 
+// RouteMeta returns the metadata of the matched route. Like RoutePattern,
+// it is only final once routing reaches the endpoint, so middlewares set
+// with Use should read it after calling the next handler.
+func (x *Context) RouteMeta() *RouteMeta {
+	return x.routeMeta
+}
+
 // RoutePattern builds the routing pattern string for the particular
 // request, at the particular point during routing. This means, the value
 // will change throughout the execution of a request in a router. That is
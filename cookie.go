@@ -0,0 +1,216 @@
+package orbit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CookieOption modifies a cookie before it is written to the response.
+type CookieOption func(c *http.Cookie)
+
+// CookiePath sets the Path attribute of a cookie. The default is "/".
+func CookiePath(path string) CookieOption {
+	return func(c *http.Cookie) { c.Path = path }
+}
+
+// CookieDomain sets the Domain attribute of a cookie.
+func CookieDomain(domain string) CookieOption {
+	return func(c *http.Cookie) { c.Domain = domain }
+}
+
+// CookieMaxAge sets the Max-Age attribute of a cookie, rounded down to
+// whole seconds.
+func CookieMaxAge(d time.Duration) CookieOption {
+	return func(c *http.Cookie) { c.MaxAge = int(d / time.Second) }
+}
+
+// CookieSameSite overrides the default SameSite=Lax attribute.
+func CookieSameSite(s http.SameSite) CookieOption {
+	return func(c *http.Cookie) { c.SameSite = s }
+}
+
+// CookieInsecure drops the Secure attribute, for local development over
+// plain http.
+func CookieInsecure() CookieOption {
+	return func(c *http.Cookie) { c.Secure = false }
+}
+
+// CookieScriptAccess drops the HttpOnly attribute so the cookie can be
+// read by client side scripts.
+func CookieScriptAccess() CookieOption {
+	return func(c *http.Cookie) { c.HttpOnly = false }
+}
+
+// newCookie returns a cookie with orbit's safe defaults applied: Path=/,
+// HttpOnly, Secure and SameSite=Lax.
+func newCookie(name, value string, opts []CookieOption) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var (
+	// ErrCookieInvalid is returned by SecureCookie.Decode when a value has
+	// been tampered with, was signed by an unknown key or is malformed.
+	ErrCookieInvalid = errors.New("orbit: invalid cookie value")
+
+	// ErrCookieExpired is returned by SecureCookie.Decode when a value is
+	// older than the codec's max age.
+	ErrCookieExpired = errors.New("orbit: expired cookie value")
+
+	// ErrCookieTooLong is returned by SecureCookie.Encode when the encoded
+	// value would not fit in a browser cookie.
+	ErrCookieTooLong = errors.New("orbit: encoded cookie value is too long")
+)
+
+// maxCookieLength is the largest encoded value a SecureCookie will produce.
+// Browsers commonly cap a cookie, name and attributes included, at 4096 bytes.
+const maxCookieLength = 4000
+
+// CookieKey is a key pair used by SecureCookie. Hash signs values with
+// HMAC-SHA256 and is required. Block, when set, encrypts values with
+// AES-GCM and must be 16, 24 or 32 bytes long.
+type CookieKey struct {
+	Hash  []byte
+	Block []byte
+}
+
+type cookieKey struct {
+	hash []byte
+	aead cipher.AEAD
+}
+
+// SecureCookie encodes and decodes authenticated, and optionally encrypted,
+// cookie values. The first key is used to encode new values while every key
+// is tried when decoding, so keys can be rotated without logging out users.
+type SecureCookie struct {
+	keys   []cookieKey
+	maxAge time.Duration
+}
+
+// NewSecureCookie returns a codec that signs with the `current` key and
+// still accepts values signed by any of the `old` keys. Values older than
+// 30 days are rejected; see MaxAge.
+func NewSecureCookie(current CookieKey, old ...CookieKey) (*SecureCookie, error) {
+	s := &SecureCookie{maxAge: 30 * 24 * time.Hour}
+	for _, k := range append([]CookieKey{current}, old...) {
+		if len(k.Hash) == 0 {
+			return nil, errors.New("orbit: secure cookie hash key is required")
+		}
+		ck := cookieKey{hash: k.Hash}
+		if len(k.Block) > 0 {
+			block, err := aes.NewCipher(k.Block)
+			if err != nil {
+				return nil, fmt.Errorf("orbit: secure cookie block key: %w", err)
+			}
+			ck.aead, err = cipher.NewGCM(block)
+			if err != nil {
+				return nil, fmt.Errorf("orbit: secure cookie block key: %w", err)
+			}
+		}
+		s.keys = append(s.keys, ck)
+	}
+	return s, nil
+}
+
+// MaxAge sets how long an encoded value stays valid. A zero duration
+// disables the check.
+func (s *SecureCookie) MaxAge(d time.Duration) *SecureCookie {
+	s.maxAge = d
+	return s
+}
+
+// Encode signs, and encrypts if a block key is set, `value` for the cookie
+// `name`. The name is bound into the signature so a value can't be moved
+// to a different cookie.
+func (s *SecureCookie) Encode(name, value string) (string, error) {
+	k := s.keys[0]
+
+	payload := []byte(value)
+	if k.aead != nil {
+		nonce := make([]byte, k.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = k.aead.Seal(nonce, nonce, payload, []byte(name))
+	}
+
+	raw := make([]byte, 8, 8+len(payload)+sha256.Size)
+	binary.BigEndian.PutUint64(raw, uint64(time.Now().Unix()))
+	raw = append(raw, payload...)
+	raw = append(raw, cookieMAC(k.hash, name, raw)...)
+
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	if len(encoded) > maxCookieLength {
+		return "", ErrCookieTooLong
+	}
+	return encoded, nil
+}
+
+// Decode verifies and decodes a value produced by Encode for the cookie
+// `name`.
+func (s *SecureCookie) Decode(name, encoded string) (string, error) {
+	if len(encoded) > maxCookieLength {
+		return "", ErrCookieInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < 8+sha256.Size {
+		return "", ErrCookieInvalid
+	}
+	msg, mac := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+
+	for _, k := range s.keys {
+		if !hmac.Equal(mac, cookieMAC(k.hash, name, msg)) {
+			continue
+		}
+
+		ts := time.Unix(int64(binary.BigEndian.Uint64(msg[:8])), 0)
+		if s.maxAge > 0 && time.Since(ts) > s.maxAge {
+			return "", ErrCookieExpired
+		}
+		if time.Until(ts) > time.Minute {
+			return "", ErrCookieInvalid
+		}
+
+		payload := msg[8:]
+		if k.aead != nil {
+			ns := k.aead.NonceSize()
+			if len(payload) < ns {
+				return "", ErrCookieInvalid
+			}
+			payload, err = k.aead.Open(nil, payload[:ns], payload[ns:], []byte(name))
+			if err != nil {
+				return "", ErrCookieInvalid
+			}
+		}
+		return string(payload), nil
+	}
+
+	return "", ErrCookieInvalid
+}
+
+func cookieMAC(key []byte, name string, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(msg)
+	return h.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package orbit
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	cookieHashKey  = []byte("0123456789abcdef0123456789abcdef")
+	cookieBlockKey = []byte("fedcba9876543210")
+)
+
+func mustSecureCookie(t *testing.T, current CookieKey, old ...CookieKey) *SecureCookie {
+	t.Helper()
+	sc, err := NewSecureCookie(current, old...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+// signedAt encodes `value` like Encode would have at `ts`, without
+// encryption.
+func signedAt(key []byte, name, value string, ts time.Time) string {
+	raw := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(raw, uint64(ts.Unix()))
+	raw = append(raw, value...)
+	raw = append(raw, cookieMAC(key, name, raw)...)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestSecureCookieRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		key  CookieKey
+	}{
+		{"Signed", CookieKey{Hash: cookieHashKey}},
+		{"Encrypted", CookieKey{Hash: cookieHashKey, Block: cookieBlockKey}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := mustSecureCookie(t, tt.key)
+			enc, err := sc.Encode("session", "user=42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := sc.Decode("session", enc); err != nil || got != "user=42" {
+				t.Errorf("Decode() = %q, %v; want %q", got, err, "user=42")
+			}
+			if tt.key.Block != nil && strings.Contains(enc, base64.RawURLEncoding.EncodeToString([]byte("user=42"))) {
+				t.Error("encrypted value carries the plaintext")
+			}
+			if _, err := sc.Decode("other", enc); !errors.Is(err, ErrCookieInvalid) {
+				t.Errorf("Decode() under another name = %v, want ErrCookieInvalid", err)
+			}
+		})
+	}
+
+	if _, err := mustSecureCookie(t, CookieKey{Hash: cookieHashKey}).Encode("big", strings.Repeat("x", maxCookieLength)); !errors.Is(err, ErrCookieTooLong) {
+		t.Errorf("Encode() of a large value = %v, want ErrCookieTooLong", err)
+	}
+}
+
+func TestSecureCookieTamper(t *testing.T) {
+	sc := mustSecureCookie(t, CookieKey{Hash: cookieHashKey, Block: cookieBlockKey})
+	enc, err := sc.Encode("session", "user=42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(enc)
+
+	for i := range raw {
+		tampered := append([]byte(nil), raw...)
+		tampered[i] ^= 1
+		if _, err := sc.Decode("session", base64.RawURLEncoding.EncodeToString(tampered)); !errors.Is(err, ErrCookieInvalid) {
+			t.Fatalf("Decode() with byte %d flipped = %v, want ErrCookieInvalid", i, err)
+		}
+	}
+	for _, v := range []string{"", "not base64!", base64.RawURLEncoding.EncodeToString(raw[:20]), strings.Repeat("A", maxCookieLength+1)} {
+		if _, err := sc.Decode("session", v); !errors.Is(err, ErrCookieInvalid) {
+			t.Errorf("Decode(%.20q) = %v, want ErrCookieInvalid", v, err)
+		}
+	}
+}
+
+func TestSecureCookieTimestamp(t *testing.T) {
+	sc := mustSecureCookie(t, CookieKey{Hash: cookieHashKey}).MaxAge(time.Hour)
+
+	for _, tt := range []struct {
+		name string
+		at   time.Time
+		err  error
+	}{
+		{"Fresh", time.Now().Add(-time.Minute), nil},
+		{"Expired", time.Now().Add(-2 * time.Hour), ErrCookieExpired},
+		{"Future", time.Now().Add(time.Hour), ErrCookieInvalid},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sc.Decode("session", signedAt(cookieHashKey, "session", "v", tt.at))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Decode() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	old := signedAt(cookieHashKey, "session", "v", time.Now().Add(-1000*time.Hour))
+	if _, err := sc.MaxAge(0).Decode("session", old); err != nil {
+		t.Errorf("Decode() without max age = %v", err)
+	}
+}
+
+// Values signed by an old key still decode, new values use the current key.
+func TestSecureCookieKeyRotation(t *testing.T) {
+	oldKey := CookieKey{Hash: []byte("old hash key"), Block: cookieBlockKey}
+	newKey := CookieKey{Hash: cookieHashKey, Block: []byte("0123456789abcdef0123456789abcdef")}
+
+	before := mustSecureCookie(t, oldKey)
+	enc, err := before.Encode("session", "user=42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := mustSecureCookie(t, newKey, oldKey)
+	if got, err := rotated.Decode("session", enc); err != nil || got != "user=42" {
+		t.Errorf("Decode() of an old value = %q, %v", got, err)
+	}
+	fresh, err := rotated.Encode("session", "user=42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Decode("session", fresh); !errors.Is(err, ErrCookieInvalid) {
+		t.Errorf("new value decoded with the old key alone: %v", err)
+	}
+	if _, err := mustSecureCookie(t, newKey).Decode("session", enc); !errors.Is(err, ErrCookieInvalid) {
+		t.Errorf("old value decoded once the old key is dropped: %v", err)
+	}
+
+	if _, err := NewSecureCookie(CookieKey{}); err == nil {
+		t.Error("NewSecureCookie() accepted a key without hash")
+	}
+	if _, err := NewSecureCookie(CookieKey{Hash: cookieHashKey, Block: []byte("short")}); err == nil {
+		t.Error("NewSecureCookie() accepted a bad block key")
+	}
+}
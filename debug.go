@@ -0,0 +1,328 @@
+package orbit
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ArminasAer/orbit/internal/funcinfo"
+)
+
+// DebugHandler returns a router exposing the live routing table of `o`
+// for troubleshooting 404s and 405s, e.g.
+//
+//	o.Mount("/_orbit", orbit.DebugHandler(o))
+//
+// It serves an HTML page with the routes, their middleware chains, the
+// methods added with RegisterMethod and a match tester, plus the same data
+// as JSON at /routes.json and /match.json?method=GET&path=/users/1. The
+// match goes through host and version routers too, with the host of the
+// optional host parameter and the headers of the debug request, and reports
+// the redirects of path policies.
+//
+// The page reveals the internals of the application, so don't mount it
+// without access control in production.
+func DebugHandler(o *Orbit) Handler {
+	d := NewPlanet()
+
+	d.Get("/", func(b Bits) error {
+		q := b.Request().URL.Query()
+		page := debugPage{Routes: debugRoutes(o), Methods: customMethods()}
+		if path := q.Get("path"); path != "" {
+			m := debugMatchRoute(o, b.Request(), q.Get("method"), path, q.Get("host"))
+			page.Match = &m
+		}
+		b.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+		return debugTemplate.Execute(b.Response(), page)
+	})
+
+	d.Get("/routes.json", func(b Bits) error {
+		return writeDebugJSON(b, map[string]interface{}{
+			"routes":  debugRoutes(o),
+			"methods": customMethods(),
+		})
+	})
+
+	d.Get("/match.json", func(b Bits) error {
+		q := b.Request().URL.Query()
+		return writeDebugJSON(b, debugMatchRoute(o, b.Request(), q.Get("method"), q.Get("path"), q.Get("host")))
+	})
+
+	return d
+}
+
+type debugRoute struct {
+	Method      string   `json:"method"`
+	Host        string   `json:"host,omitempty"`
+	Pattern     string   `json:"pattern"`
+	Matchers    []string `json:"matchers,omitempty"`
+	Versions    []string `json:"versions,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+}
+
+type debugNode struct {
+	Router  int    `json:"router"`
+	Type    string `json:"type"`
+	Prefix  string `json:"prefix"`
+	Pattern string `json:"pattern"`
+}
+
+type debugParam struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type debugMatch struct {
+	Method           string       `json:"method"`
+	Path             string       `json:"path"`
+	Host             string       `json:"host,omitempty"`
+	Matched          bool         `json:"matched"`
+	Redirect         string       `json:"redirect,omitempty"`
+	MethodNotAllowed bool         `json:"methodNotAllowed"`
+	Allowed          []string     `json:"allowed,omitempty"`
+	Nodes            []debugNode  `json:"nodes"`
+	URLParams        []debugParam `json:"urlParams"`
+	RoutePatterns    []string     `json:"routePatterns"`
+	RoutePattern     string       `json:"routePattern"`
+}
+
+type debugPage struct {
+	Routes  []debugRoute
+	Methods []string
+	Match   *debugMatch
+}
+
+func debugRoutes(o *Orbit) []debugRoute {
+	routes := []debugRoute{}
+	WalkRoutes(o, func(ri RouteInfo) error {
+		dr := debugRoute{Method: ri.Method, Host: ri.Host, Pattern: ri.Route, Matchers: ri.Matchers, Versions: ri.Versions, Middlewares: []string{}}
+		dr.Handler, _ = funcinfo.Lookup(ri.Handler)
+		if ri.Meta != nil {
+			dr.Name = ri.Meta.Name
+		}
+		for _, mw := range ri.Middlewares {
+			name, _ := funcinfo.Lookup(mw)
+			dr.Middlewares = append(dr.Middlewares, name)
+		}
+		routes = append(routes, dr)
+		return nil
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// customMethods returns the methods added with RegisterMethod.
+func customMethods() []string {
+	methods := []string{}
+	for name, m := range methodMap {
+		if _, ok := reverseMethodMap[m]; !ok {
+			methods = append(methods, name)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// debugMatchRoute routes `method` and `path` through `o` like a request
+// would, descending into mounted sub-routers, host and version routers, and
+// records every node that matched along the way. The headers of `r`, the
+// request of the debug page, are used for the version, and `host` for the
+// host if set.
+func debugMatchRoute(o *Orbit, r *http.Request, method, path, host string) debugMatch {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	res := debugMatch{Method: method, Path: path, Host: host, Nodes: []debugNode{}, URLParams: []debugParam{}}
+
+	m, ok := methodMap[method]
+	if !ok || path == "" || path[0] != '/' {
+		return res
+	}
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		return res
+	}
+	req.Header = r.Header.Clone()
+	req.Host = r.Host
+	if host != "" {
+		req.Host = host
+	}
+
+	rctx := NewRouteContext()
+	rctx.matchRequest = req
+	routes := Routes(o)
+	routePath := requestPath(req)
+	for level := 0; ; level++ {
+		rctx.Routes = routes
+
+		var next Handler
+		switch rt := routes.(type) {
+		case *Hosts:
+			hr := rt.route(requestHost(req), &rctx.URLParams)
+			if hr == nil {
+				break
+			}
+			res.Nodes = append(res.Nodes, debugNode{Router: level, Type: "host", Prefix: hr.pattern})
+			next = hr.handler
+
+		case *Versions:
+			av, rest, code := rt.resolve(req, routePath)
+			if code != 0 || av == nil {
+				break
+			}
+			res.Nodes = append(res.Nodes, debugNode{Router: level, Type: "version", Prefix: av.name})
+			next = rt.fallback(av, method, rest)
+			routePath = rest
+
+		case *Orbit:
+			// Mirror routeHTTP, which applies the path policy of the
+			// router: unclean paths and trailing slashes redirect, and
+			// case insensitive routers fold the case of the path.
+			if clean, ok := rt.cleanTarget(routePath); ok {
+				res.Redirect = redirectLocation(req, routePath, clean)
+				break
+			}
+			rctx.foldCase = rt.pathPolicy != nil && rt.pathPolicy.CaseInsensitive
+			n, _, h := rt.root().FindRoute(rctx, m, routePath)
+			if h == nil && !rctx.methodNotAllowed {
+				if alt, an, ah := rt.trailingSlashRoute(rctx, m, routePath); ah != nil {
+					if rt.pathPolicy.TrailingSlash == TrailingSlashRedirect {
+						res.Redirect = redirectLocation(req, routePath, alt)
+						break
+					}
+					n, h = an, ah
+				}
+			}
+			if n == nil {
+				break
+			}
+			dn := debugNode{Router: level, Type: nodeTypString(n.typ), Prefix: n.prefix}
+			if ep := n.endpoints[m]; ep != nil {
+				dn.Pattern = ep.pattern
+			}
+			res.Nodes = append(res.Nodes, dn)
+			if n.subroutes == nil {
+				res.Matched = h != nil
+				break
+			}
+			// Mirror the mount handler, which hands the wildcard over to the
+			// sub-router.
+			routePath = rt.nextRoutePath(rctx)
+			if k := len(rctx.URLParams.Keys) - 1; k >= 0 && rctx.URLParams.Keys[k] == "*" {
+				rctx.URLParams.Values[k] = ""
+			}
+			routes = n.subroutes
+			continue
+		}
+
+		if next == nil {
+			break
+		}
+		sub, ok := next.(Routes)
+		if !ok {
+			// A plain handler serves whatever reaches it.
+			res.Matched = true
+			break
+		}
+		routes = sub
+	}
+
+	if !res.Matched && rctx.methodNotAllowed {
+		res.MethodNotAllowed = true
+		for _, mt := range rctx.methodsAllowed {
+			res.Allowed = append(res.Allowed, methodTypString(mt))
+		}
+		sort.Strings(res.Allowed)
+	}
+	for i, k := range rctx.URLParams.Keys {
+		res.URLParams = append(res.URLParams, debugParam{Key: k, Value: rctx.URLParams.Values[i]})
+	}
+	res.RoutePatterns = append([]string{}, rctx.RoutePatterns...)
+	res.RoutePattern = rctx.RoutePattern()
+	return res
+}
+
+func nodeTypString(t nodeTyp) string {
+	switch t {
+	case ntStatic:
+		return "static"
+	case ntRegexp:
+		return "regexp"
+	case ntParam:
+		return "param"
+	case ntCatchAll:
+		return "catch-all"
+	}
+	return "unknown"
+}
+
+func writeDebugJSON(b Bits, v interface{}) error {
+	b.Response().Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(b.Response())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Orbit routes</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>💫 Orbit routes 🪐</h1>
+
+<h2>Match tester</h2>
+<form method="get">
+<input name="method" size="8" value="{{if .Match}}{{.Match.Method}}{{else}}GET{{end}}">
+<input name="path" size="60" placeholder="/users/42" value="{{if .Match}}{{.Match.Path}}{{end}}">
+<input name="host" size="30" placeholder="host" value="{{if .Match}}{{.Match.Host}}{{end}}">
+<button type="submit">Match</button>
+</form>
+{{with .Match}}
+<p>
+{{if .Matched}}<strong>Matched</strong> <code>{{.RoutePattern}}</code>
+{{else if .Redirect}}<strong>Redirect</strong> to <code>{{.Redirect}}</code>
+{{else if .MethodNotAllowed}}<strong>405 Method Not Allowed</strong>, allowed: {{range .Allowed}}<code>{{.}}</code> {{end}}
+{{else}}<strong>404 Not Found</strong>{{end}}
+</p>
+<table>
+<tr><th>Router</th><th>Node type</th><th>Node prefix</th><th>Endpoint pattern</th></tr>
+{{range .Nodes}}<tr><td>{{.Router}}</td><td>{{.Type}}</td><td><code>{{.Prefix}}</code></td><td><code>{{.Pattern}}</code></td></tr>
+{{end}}
+</table>
+<p>URL params: {{range .URLParams}}<code>{{.Key}}={{.Value}}</code> {{else}}none{{end}}</p>
+<p>Route patterns: {{range .RoutePatterns}}<code>{{.}}</code> {{else}}none{{end}}</p>
+{{end}}
+
+<h2>Routes</h2>
+<table>
+<tr><th>Method</th><th>Host</th><th>Pattern</th><th>Name</th><th>Handler</th><th>Middlewares</th></tr>
+{{range .Routes}}<tr><td>{{.Method}}</td><td>{{.Host}}</td><td><code>{{.Pattern}}</code>{{range .Matchers}}<br><small>{{.}}</small>{{end}}</td><td>{{.Name}}</td><td><code>{{.Handler}}</code></td><td>{{range .Middlewares}}<code>{{.}}</code><br>{{end}}</td></tr>
+{{end}}
+</table>
+
+<h2>Custom methods</h2>
+<p>{{range .Methods}}<code>{{.}}</code> {{else}}none{{end}}</p>
+</body>
+</html>
+`))
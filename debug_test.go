@@ -0,0 +1,61 @@
+package orbit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugRoutesHost(t *testing.T) {
+	api, www := NewOrbit(), NewOrbit()
+	api.Get("/users", func(b Bits) error { return nil })
+	www.Get("/users", func(b Bits) error { return nil })
+	h := NewHosts()
+	h.Host("api.example.com", api)
+	h.Host("www.example.com", www)
+	o := NewOrbit()
+	o.Mount("/", h)
+
+	var hosts []string
+	for _, dr := range debugRoutes(o) {
+		if dr.Pattern == "/users" {
+			hosts = append(hosts, dr.Host)
+		}
+	}
+	if len(hosts) != 2 || hosts[0] != "api.example.com" || hosts[1] != "www.example.com" {
+		t.Errorf("hosts of /users = %q", hosts)
+	}
+}
+
+// The match tester reports what ServeHTTP would do under the path policy.
+func TestDebugMatchPathPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy   PathPolicy
+		path     string
+		matched  bool
+		redirect string
+	}{
+		{PathPolicy{}, "/api/users//42", false, ""},
+		{PathPolicy{CleanPath: true}, "/api/users//42?x=1", false, "/api/users/42?x=1"},
+		{PathPolicy{CleanPath: true}, "/api/users/42", true, ""},
+		{PathPolicy{}, "/api/users/42/", false, ""},
+		{PathPolicy{TrailingSlash: TrailingSlashRedirect}, "/api/users/42/", false, "/api/users/42"},
+		{PathPolicy{TrailingSlash: TrailingSlashServe}, "/api/users/42/", true, ""},
+	} {
+		api := NewOrbit()
+		api.Get("/users/{id}", func(b Bits) error { return nil })
+		o := NewOrbit()
+		o.PathPolicy(tt.policy)
+		o.Mount("/api", api)
+
+		m := debugMatchRoute(o, httptest.NewRequest("GET", "/_orbit", nil), "GET", tt.path, "")
+		if m.Matched != tt.matched || m.Redirect != tt.redirect {
+			t.Errorf("%+v %s: matched %v, redirect %q, want %v, %q", tt.policy, tt.path, m.Matched, m.Redirect, tt.matched, tt.redirect)
+		}
+
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if loc := w.Header().Get("Location"); loc != tt.redirect || (w.Code == 200) != tt.matched {
+			t.Errorf("%+v %s: served %d, Location %q", tt.policy, tt.path, w.Code, loc)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package docgen generates Markdown and JSON documentation for any
+// orbit.Routes, meant to be checked into a repository so route changes
+// show up in code review.
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ArminasAer/orbit"
+	"github.com/ArminasAer/orbit/internal/funcinfo"
+)
+
+// Route documents a single method and route.
+type Route struct {
+	Method      string   `json:"method"`
+	Host        string   `json:"host,omitempty"`
+	Pattern     string   `json:"pattern"`
+	Matchers    []string `json:"matchers,omitempty"`
+	Versions    []string `json:"versions,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+	Source      string   `json:"source,omitempty"`
+}
+
+// Options configures the generated documentation.
+type Options struct {
+	// SourceRoot is trimmed from source file paths so the output is the
+	// same on every machine. Defaults to the working directory.
+	SourceRoot string
+}
+
+// Routes walks `r`, mounted sub-routers included, and describes every
+// route, sorted by host, pattern and method.
+func Routes(r orbit.Routes, opts Options) ([]Route, error) {
+	root := opts.SourceRoot
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+
+	routes := []Route{}
+	err := orbit.WalkRoutes(r, func(ri orbit.RouteInfo) error {
+		rt := Route{
+			Method:      ri.Method,
+			Host:        ri.Host,
+			Pattern:     ri.Route,
+			Matchers:    ri.Matchers,
+			Versions:    ri.Versions,
+			Middlewares: make([]string, 0, len(ri.Middlewares)),
+		}
+		if ri.Meta != nil {
+			rt.Name = ri.Meta.Name
+			rt.Summary = ri.Meta.Summary
+			rt.Deprecated = ri.Meta.Deprecated
+		}
+
+		var file string
+		rt.Handler, file = funcinfo.Lookup(ri.Handler)
+		if file != "" {
+			rt.Source = relPath(root, file)
+		}
+		for _, mw := range ri.Middlewares {
+			name, _ := funcinfo.Lookup(mw)
+			rt.Middlewares = append(rt.Middlewares, name)
+		}
+
+		routes = append(routes, rt)
+		return nil
+	})
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes, err
+}
+
+// JSON writes the routes of `r` as an indented JSON array.
+func JSON(w io.Writer, r orbit.Routes, opts Options) error {
+	routes, err := Routes(r, opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(routes)
+}
+
+// Markdown writes the routes of `r` as a Markdown table. A Host column is
+// added when `r` routes on host names.
+func Markdown(w io.Writer, r orbit.Routes, opts Options) error {
+	routes, err := Routes(r, opts)
+	if err != nil {
+		return err
+	}
+
+	withHost := false
+	for _, rt := range routes {
+		withHost = withHost || rt.Host != ""
+	}
+
+	var sb strings.Builder
+	if withHost {
+		sb.WriteString("| Host | Method | Pattern | Name | Handler | Middlewares | Source |\n")
+		sb.WriteString("|------|--------|---------|------|---------|-------------|--------|\n")
+	} else {
+		sb.WriteString("| Method | Pattern | Name | Handler | Middlewares | Source |\n")
+		sb.WriteString("|--------|---------|------|---------|-------------|--------|\n")
+	}
+	for _, rt := range routes {
+		pattern := "`" + rt.Pattern + "`"
+		if rt.Deprecated {
+			pattern = "~~" + pattern + "~~"
+		}
+		if len(rt.Matchers) > 0 {
+			pattern += " when " + strings.Join(rt.Matchers, ", ")
+		}
+		if withHost {
+			fmt.Fprintf(&sb, "| %s ", mdEscape(rt.Host))
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s |\n",
+			rt.Method,
+			mdEscape(pattern),
+			mdEscape(rt.Name),
+			mdEscape(rt.Handler),
+			mdEscape(strings.Join(rt.Middlewares, " → ")),
+			mdEscape(rt.Source),
+		)
+	}
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func relPath(root, file string) string {
+	if root != "" {
+		if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(file)
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
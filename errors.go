@@ -0,0 +1,103 @@
+package orbit
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPError is an error that carries the response it should produce. Return
+// it from a handler, or pass it to Error from a middleware, to respond with
+// something other than a 500.
+type HTTPError struct {
+	// Code is the HTTP status code of the response.
+	Code int
+
+	// Message is sent to the client. It defaults to the status text.
+	Message string
+
+	// Header holds extra response headers, such as WWW-Authenticate.
+	Header http.Header
+
+	// Err is the underlying cause. It is never sent to the client.
+	Err error
+}
+
+// NewHTTPError returns an HTTPError for `code` with an optional message. A
+// zero code means 500.
+func NewHTTPError(code int, message ...string) *HTTPError {
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	e := &HTTPError{Code: code}
+	if len(message) > 0 {
+		e.Message = message[0]
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Code)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandlerFunc responds to an error returned by a HandlerFunc or raised
+// by a middleware through Error.
+type ErrorHandlerFunc func(b Bits, err error)
+
+// ErrorHandler sets a custom handler for errors returned by handlers served
+// by this router. It should be set on the top level Orbit, which is the one
+// consulted for every request it serves, mounted sub-routers included.
+func (o *Orbit) ErrorHandler(fn ErrorHandlerFunc) {
+	o.owner().errorHandler = fn
+}
+
+// DefaultErrorHandler responds with the status, headers and message of an
+// HTTPError, or with a bare 500 for any other error.
+func DefaultErrorHandler(b Bits, err error) {
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		http.Error(b.Response(), http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	code := he.Code
+	if code < 100 || code > 999 {
+		code = http.StatusInternalServerError
+	}
+	for k, vs := range he.Header {
+		for _, v := range vs {
+			b.Response().Header().Add(k, v)
+		}
+	}
+	msg := he.Message
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	http.Error(b.Response(), msg, code)
+}
+
+// Error sends `err` through the error handler of the router serving the
+// request. It is how middlewares, which don't return errors, report them.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	handleError(&bits{response: w, request: r}, err)
+}
+
+func handleError(b *bits, err error) {
+	if rctx := RouteContext(b.request.Context()); rctx != nil {
+		if o, ok := rctx.Routes.(*Orbit); ok && o.errorHandler != nil {
+			o.errorHandler(b, err)
+			return
+		}
+	}
+	DefaultErrorHandler(b, err)
+}
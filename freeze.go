@@ -0,0 +1,239 @@
+package orbit
+
+import "sort"
+
+// Freeze compiles the routing tree of the router, and of the sub-routers
+// mounted on it, for faster lookups. Fully static paths are resolved with
+// a minimal perfect hash and a precomputed bitmap of their methods, without
+// walking the tree. Other paths walk the tree, whose nodes hold the bitmaps
+// of their methods and their children in a single array.
+//
+// Launch calls Freeze. Routes can still be changed afterwards, the tree is
+// compiled again on every change, which makes them slower. Outside Hot
+// mode, the tree is compiled in place, like adding a route changes it, so
+// Freeze must not run while requests are served; in Hot mode it compiles
+// a copy and publishes it.
+//
+// Sub-routers mounted through host and version routers are frozen too.
+func (o *Orbit) Freeze() {
+	m := o.owner()
+	unlock := m.lock()
+	m.frozen = true
+	m.publish(m.writableTree())
+	unlock()
+	m.checkStrictReport("")
+
+	for _, r := range m.root().routes() {
+		freezeRoutes(r.SubRoutes)
+	}
+}
+
+// Freeze freezes the routers of every host, see Orbit.Freeze.
+func (h *Hosts) Freeze() {
+	for _, hr := range h.hosts {
+		freezeRoutes(hr.handler)
+	}
+}
+
+// Freeze freezes the routers of every version, see Orbit.Freeze.
+func (v *Versions) Freeze() {
+	for _, av := range v.versions {
+		freezeRoutes(av.handler)
+	}
+}
+
+// freezeRoutes freezes `h` if it is a router that can be frozen.
+func freezeRoutes(h interface{}) {
+	if f, ok := h.(interface{ Freeze() }); ok {
+		f.Freeze()
+	}
+}
+
+// staticTable is a minimal perfect hash of the fully static paths of a
+// tree, built with the hash and displace method: the keys of a bucket are
+// placed with the seed stored for the bucket.
+type staticTable struct {
+	seeds   []uint32
+	entries []staticEntry
+	mask    uint32
+}
+
+type staticEntry struct {
+	path    string
+	node    *node
+	methods methodTyp
+}
+
+// freeze compiles the tree: the static table of its fully static paths,
+// and the method bitmaps and flattened children of its nodes.
+func (n *node) freeze() {
+	n.freezeNodes()
+	var entries []staticEntry
+	n.collectStatic("", &entries)
+	n.static = newStaticTable(entries)
+}
+
+// freezeNodes computes the method bitmaps of the leaves, so that matching
+// a method or listing the allowed ones doesn't go through the endpoints
+// map, and moves the children of each node, of every type, into a single
+// array in the order they are walked. The groups are capped so that adding
+// a route copies them rather than writing over the next group.
+func (n *node) freezeNodes() {
+	n.methods, n.allowed = 0, 0
+	for m, ep := range n.endpoints {
+		if m == mALL || m == mSTUB {
+			continue
+		}
+		n.allowed |= m
+		if ep.handler != nil {
+			n.methods |= m
+		}
+	}
+	n.frozen = true
+
+	size := 0
+	for _, nds := range n.children {
+		size += len(nds)
+	}
+	if size == 0 {
+		return
+	}
+	flat := make(nodes, 0, size)
+	for t, nds := range n.children {
+		if len(nds) == 0 {
+			continue
+		}
+		lo := len(flat)
+		flat = append(flat, nds...)
+		n.children[t] = flat[lo:len(flat):len(flat)]
+	}
+	for _, cn := range flat {
+		cn.freezeNodes()
+	}
+}
+
+// collectStatic adds the leaf nodes reached through static nodes only.
+func (n *node) collectStatic(prefix string, entries *[]staticEntry) {
+	if n.typ != ntStatic {
+		return
+	}
+	prefix += n.prefix
+
+	if n.methods != 0 {
+		*entries = append(*entries, staticEntry{path: prefix, node: n, methods: n.methods})
+	}
+
+	for _, cn := range n.children[ntStatic] {
+		cn.collectStatic(prefix, entries)
+	}
+}
+
+// appendMethods appends the methods of the bitmap `methods` to `dst`.
+func appendMethods(dst []methodTyp, methods methodTyp) []methodTyp {
+	for m := mSTUB << 1; m != 0 && m <= methods; m <<= 1 {
+		if methods&m != 0 {
+			dst = append(dst, m)
+		}
+	}
+	return dst
+}
+
+// maxSeed bounds the search for the seed of a bucket. It is only reached
+// if the hash is badly distributed, in which case there's no static table.
+const maxSeed = 1 << 16
+
+func newStaticTable(entries []staticEntry) *staticTable {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	size := uint32(1)
+	for size < uint32(len(entries)) {
+		size <<= 1
+	}
+	st := &staticTable{
+		seeds:   make([]uint32, (len(entries)+3)/4),
+		entries: make([]staticEntry, size),
+		mask:    size - 1,
+	}
+
+	buckets := make([][]int, len(st.seeds))
+	for i, e := range entries {
+		b := staticHash(e.path) % uint32(len(buckets))
+		buckets[b] = append(buckets[b], i)
+	}
+	order := make([]int, len(buckets))
+	for i := range order {
+		order[i] = i
+	}
+	// Place the largest buckets first, while there are free slots left.
+	sort.Slice(order, func(i, j int) bool {
+		return len(buckets[order[i]]) > len(buckets[order[j]])
+	})
+
+	used := make([]bool, size)
+	slots := make([]uint32, 0, 8)
+	for _, b := range order {
+		if len(buckets[b]) == 0 {
+			break
+		}
+	seeds:
+		for seed := uint32(1); ; seed++ {
+			if seed == maxSeed {
+				return nil
+			}
+			slots = slots[:0]
+			for _, i := range buckets[b] {
+				s := slotHash(staticHash(entries[i].path), seed) & st.mask
+				if used[s] {
+					continue seeds
+				}
+				for _, prev := range slots {
+					if prev == s {
+						continue seeds
+					}
+				}
+				slots = append(slots, s)
+			}
+			for k, i := range buckets[b] {
+				used[slots[k]] = true
+				st.entries[slots[k]] = entries[i]
+			}
+			st.seeds[b] = seed
+			break
+		}
+	}
+	return st
+}
+
+// lookup returns the entry of `path`, or nil.
+func (st *staticTable) lookup(path string) *staticEntry {
+	h := staticHash(path)
+	e := &st.entries[slotHash(h, st.seeds[h%uint32(len(st.seeds))])&st.mask]
+	if e.node == nil || e.path != path {
+		return nil
+	}
+	return e
+}
+
+// staticHash is the FNV-1a hash of `s`. Paths are hashed once per lookup,
+// the slot is derived from the hash.
+func staticHash(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// slotHash mixes the hash of a path with the seed of its bucket.
+func slotHash(h, seed uint32) uint32 {
+	h ^= seed * 0x9e3779b9
+	h ^= h >> 15
+	h *= 0x2c1b3c6d
+	h ^= h >> 12
+	h *= 0x297a2d39
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,172 @@
+package orbit
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+var findCases = []struct{ name, method, path string }{
+	{"Static", "GET", "/users"},
+	{"Param", "GET", "/users/42"},
+	{"Params", "GET", "/users/42/posts/7"},
+	{"CatchAll", "GET", "/static/css/site.css"},
+	{"NotFound", "GET", "/missing"},
+	{"NotFoundParam", "GET", "/users/42/missing"},
+	{"MethodNotAllowedStatic", "DELETE", "/users"},
+	{"MethodNotAllowedParam", "DELETE", "/users/42"},
+}
+
+func newFindTree(frozen bool) *node {
+	o := newBenchOrbit()
+	if frozen {
+		o.Freeze()
+	}
+	return o.tree
+}
+
+// The frozen tree routes every path like the tree it was compiled from.
+func TestFreezeFindRoute(t *testing.T) {
+	tree, frozen := newFindTree(false), newFindTree(true)
+	for _, fc := range findCases {
+		want, got := NewRouteContext(), NewRouteContext()
+		_, _, wh := tree.FindRoute(want, methodMap[fc.method], fc.path)
+		_, _, gh := frozen.FindRoute(got, methodMap[fc.method], fc.path)
+
+		if (wh == nil) != (gh == nil) {
+			t.Errorf("%s %s: handler found = %v, want %v", fc.method, fc.path, gh != nil, wh != nil)
+		}
+		if got.routePattern != want.routePattern {
+			t.Errorf("%s %s: pattern = %q, want %q", fc.method, fc.path, got.routePattern, want.routePattern)
+		}
+		if got.methodNotAllowed != want.methodNotAllowed {
+			t.Errorf("%s %s: methodNotAllowed = %v, want %v", fc.method, fc.path, got.methodNotAllowed, want.methodNotAllowed)
+		}
+		sortMethods(got.methodsAllowed)
+		sortMethods(want.methodsAllowed)
+		if !equalMethods(got.methodsAllowed, want.methodsAllowed) {
+			t.Errorf("%s %s: methodsAllowed = %v, want %v", fc.method, fc.path, got.methodsAllowed, want.methodsAllowed)
+		}
+		for i, k := range want.URLParams.Keys {
+			if v := got.URLParam(k); v != want.URLParams.Values[i] {
+				t.Errorf("%s %s: param %s = %q, want %q", fc.method, fc.path, k, v, want.URLParams.Values[i])
+			}
+		}
+	}
+}
+
+// Routes added to a frozen tree are compiled along with it.
+func TestFreezeAddRoute(t *testing.T) {
+	o := newBenchOrbit()
+	o.Freeze()
+	o.Delete("/users/{id}", func(b Bits) error { return nil })
+
+	rctx := NewRouteContext()
+	if _, _, h := o.tree.FindRoute(rctx, mDELETE, "/users/42"); h == nil {
+		t.Fatal("DELETE /users/42 not found after being added")
+	}
+	rctx.Reset()
+	o.tree.FindRoute(rctx, mPUT, "/users/42")
+	sortMethods(rctx.methodsAllowed)
+	if want := []methodTyp{mDELETE, mGET, mPOST}; !equalMethods(rctx.methodsAllowed, want) {
+		t.Errorf("methodsAllowed = %v, want %v", rctx.methodsAllowed, want)
+	}
+}
+
+// Every static path of a large tree gets a slot of the static table.
+func TestFreezeStaticTable(t *testing.T) {
+	o := NewOrbit()
+	h := func(b Bits) error { return nil }
+	for i := 0; i < 5000; i++ {
+		o.Get(fmt.Sprintf("/section%d/page%d", i%50, i), h)
+	}
+	o.Freeze()
+	if o.tree.static == nil {
+		t.Fatal("no static table")
+	}
+	for i := 0; i < 5000; i++ {
+		p := fmt.Sprintf("/section%d/page%d", i%50, i)
+		if e := o.tree.static.lookup(p); e == nil || e.path != p {
+			t.Fatalf("lookup(%q) = %v", p, e)
+		}
+	}
+	if e := o.tree.static.lookup("/section1/page2"); e != nil {
+		t.Errorf("lookup of a missing path = %v, want nil", e)
+	}
+}
+
+// Looking up a frozen tree doesn't allocate, whether the route is found,
+// missing or without the method.
+func TestFreezeFindRouteAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't stable under the race detector")
+	}
+	tree := newFindTree(true)
+	rctx := NewRouteContext()
+	for _, fc := range findCases {
+		method := methodMap[fc.method]
+		n := testing.AllocsPerRun(100, func() {
+			rctx.Reset()
+			tree.FindRoute(rctx, method, fc.path)
+		})
+		if n != 0 {
+			t.Errorf("%s %s: %v allocs, want 0", fc.method, fc.path, n)
+		}
+	}
+}
+
+func BenchmarkFindRoute(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		frozen bool
+	}{{"Tree", false}, {"Frozen", true}} {
+		tree := newFindTree(mode.frozen)
+		rctx := NewRouteContext()
+		for _, fc := range findCases {
+			method := methodMap[fc.method]
+			b.Run(mode.name+"/"+fc.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					rctx.Reset()
+					tree.FindRoute(rctx, method, fc.path)
+				}
+			})
+		}
+	}
+}
+
+func sortMethods(ms []methodTyp) {
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+}
+
+func equalMethods(a, b []methodTyp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Routers behind host and version routers are frozen with them.
+func TestFreezeNested(t *testing.T) {
+	api, site, inner := NewOrbit(), NewOrbit(), NewOrbit()
+	v := NewVersions(VersionOptions{Path: true})
+	v.Version("1", api)
+	site.Mount("/inner", inner)
+	h := NewHosts()
+	h.Host("api.example.com", v)
+	h.Host("example.com", site)
+
+	o := NewOrbit()
+	o.Mount("/hosts", h)
+	o.Freeze()
+	for name, r := range map[string]*Orbit{"version": api, "host": site, "mounted": inner} {
+		if !r.frozen {
+			t.Errorf("%s router isn't frozen", name)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package orbit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var _ Routes = &Hosts{}
+
+// Hosts is a router that dispatches requests on their host name, for
+// serving several sites or tenants from one process. Each host pattern
+// holds its own handler, usually an *Orbit with its own routes and
+// NotFound handling.
+//
+// Patterns are matched label by label against the request host, without
+// its port. A label can be a literal, a `{param}` capturing a single label
+// or `*` matching one or more labels at the start or end of the pattern,
+// e.g. "{tenant}.example.com" or "admin.*". Captured host params are read
+// with URLParam, like path params. More specific patterns win: the ones
+// with the most literal labels first, then the ones with the fewest
+// wildcards, then registration order.
+type Hosts struct {
+	hosts    []*hostRoute
+	notFound HandlerFunc
+	pool     *sync.Pool
+}
+
+type hostRoute struct {
+	pattern string
+	labels  []string
+	handler Handler
+	order   int
+}
+
+// NewHosts returns an empty host router.
+func NewHosts() *Hosts {
+	h := &Hosts{pool: &sync.Pool{}}
+	h.pool.New = func() interface{} {
+		return NewRouteContext()
+	}
+	return h
+}
+
+// Launch starts the server like Orbit.Launch, once the routers of the hosts
+// are frozen.
+func (h *Hosts) Launch(address string) error {
+	h.Freeze()
+	return launch(address, h)
+}
+
+// Host routes requests for hosts matching `pattern` to `handler`. It
+// panics on invalid or duplicate patterns.
+func (h *Hosts) Host(pattern string, handler Handler) {
+	if handler == nil {
+		panic(fmt.Sprintf("orbit: attempting to route a nil handler on host '%s'", pattern))
+	}
+	if v, ok := handler.(*Versions); ok {
+		v.checkDefault()
+	}
+	// Host names are case insensitive, param names are kept as written.
+	labels := strings.Split(strings.TrimSuffix(pattern, "."), ".")
+	for i, l := range labels {
+		if !strings.HasPrefix(l, "{") {
+			labels[i] = strings.ToLower(l)
+		}
+	}
+	pattern = strings.Join(labels, ".")
+	keys := map[string]bool{}
+	for i, l := range labels {
+		switch {
+		case l == "":
+			panic(fmt.Sprintf("orbit: empty label in host pattern '%s'", pattern))
+		case l == "*":
+			if i != 0 && i != len(labels)-1 {
+				panic(fmt.Sprintf("orbit: wildcard '*' must be the first or last label of host pattern '%s'", pattern))
+			}
+		case l[0] == '{':
+			if l[len(l)-1] != '}' || len(l) < 3 {
+				panic(fmt.Sprintf("orbit: invalid param '%s' in host pattern '%s'", l, pattern))
+			}
+			if keys[l] {
+				panic(fmt.Sprintf("orbit: host pattern '%s' contains duplicate param key, '%s'", pattern, l))
+			}
+			keys[l] = true
+		}
+	}
+	for _, hr := range h.hosts {
+		if hr.pattern == pattern {
+			panic(fmt.Sprintf("orbit: host pattern '%s' is already registered", pattern))
+		}
+	}
+
+	h.hosts = append(h.hosts, &hostRoute{pattern: pattern, labels: labels, handler: handler, order: len(h.hosts)})
+	sort.SliceStable(h.hosts, func(i, j int) bool {
+		li, lj := h.hosts[i].literals(), h.hosts[j].literals()
+		if li != lj {
+			return li > lj
+		}
+		wi, wj := h.hosts[i].wildcards(), h.hosts[j].wildcards()
+		if wi != wj {
+			return wi < wj
+		}
+		return h.hosts[i].order < h.hosts[j].order
+	})
+}
+
+// NotFound sets the handler for requests whose host matches no pattern.
+// The default responds with a 404.
+func (h *Hosts) NotFound(handlerFn HandlerFunc) {
+	h.notFound = handlerFn
+}
+
+// ServeHTTP dispatches the request to the handler of the first matching
+// host pattern, with the captured host params set on the routing context.
+func (h *Hosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rctx, _ := r.Context().Value(RouteCtxKey).(*Context)
+	if rctx == nil {
+		rctx = h.pool.Get().(*Context)
+		rctx.Reset()
+		var rc *requestContext
+		r, rc = withRouteContext(r, rctx)
+		defer h.pool.Put(rctx)
+		defer rc.release()
+	}
+
+	if hr := h.route(requestHost(r), &rctx.URLParams); hr != nil {
+		if routes, ok := hr.handler.(Routes); ok {
+			rctx.Routes = routes
+		}
+		hr.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if h.notFound != nil {
+		h.notFound.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "404 page not found", http.StatusNotFound)
+}
+
+// Routes returns a Route for every host, with the host handler as its
+// sub-routes when it is a router.
+func (h *Hosts) Routes() []Route {
+	routes := make([]Route, 0, len(h.hosts))
+	for _, hr := range h.hosts {
+		rt := Route{Host: hr.pattern, Pattern: ""}
+		if sr, ok := hr.handler.(Routes); ok {
+			rt.SubRoutes = sr
+		} else {
+			rt.Pattern = "/*"
+			rt.Handlers = map[string]Handler{"*": hr.handler}
+			for m := range methodMap {
+				rt.Handlers[m] = hr.handler
+			}
+		}
+		routes = append(routes, rt)
+	}
+	return routes
+}
+
+// Middlewares returns nil, host routers have no middleware stack.
+func (h *Hosts) Middlewares() Middlewares {
+	return nil
+}
+
+// Match reports whether any host router matches the method/path.
+func (h *Hosts) Match(rctx *Context, method, path string) bool {
+	for _, hr := range h.hosts {
+		if sr, ok := hr.handler.(Routes); ok && sr.Match(rctx, method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hr *hostRoute) literals() int {
+	n := 0
+	for _, l := range hr.labels {
+		if l != "*" && l[0] != '{' {
+			n++
+		}
+	}
+	return n
+}
+
+func (hr *hostRoute) wildcards() int {
+	n := 0
+	for _, l := range hr.labels {
+		if l == "*" {
+			n++
+		}
+	}
+	return n
+}
+
+// route returns the first host route matching `host`, with its params
+// added to `params`, or nil.
+func (h *Hosts) route(host string, params *RouteParams) *hostRoute {
+	for _, hr := range h.hosts {
+		n := len(params.Keys)
+		if hr.match(host, params) {
+			return hr
+		}
+		params.Keys = params.Keys[:n]
+		params.Values = params.Values[:n]
+	}
+	return nil
+}
+
+// match matches `host` against the pattern labels, adding captured params
+// to `params`.
+func (hr *hostRoute) match(host string, params *RouteParams) bool {
+	labels := strings.Split(host, ".")
+	pat := hr.labels
+
+	// Anchor wildcards by trimming the fixed labels off the other end.
+	if pat[0] == "*" && pat[len(pat)-1] == "*" && len(pat) > 1 {
+		return hr.matchFloating(labels, params)
+	}
+	if pat[0] == "*" {
+		if len(labels) < len(pat) {
+			return false
+		}
+		return matchLabels(pat[1:], labels[len(labels)-len(pat)+1:], params)
+	}
+	if pat[len(pat)-1] == "*" {
+		if len(labels) < len(pat) {
+			return false
+		}
+		return matchLabels(pat[:len(pat)-1], labels[:len(pat)-1], params)
+	}
+	if len(labels) != len(pat) {
+		return false
+	}
+	return matchLabels(pat, labels, params)
+}
+
+// matchFloating matches "*.middle.*" patterns, where the fixed labels can
+// sit anywhere with at least one label on either side.
+func (hr *hostRoute) matchFloating(labels []string, params *RouteParams) bool {
+	mid := hr.labels[1 : len(hr.labels)-1]
+	for start := 1; start+len(mid) < len(labels); start++ {
+		n := len(params.Keys)
+		if matchLabels(mid, labels[start:start+len(mid)], params) {
+			return true
+		}
+		params.Keys = params.Keys[:n]
+		params.Values = params.Values[:n]
+	}
+	return false
+}
+
+func matchLabels(pat, labels []string, params *RouteParams) bool {
+	for i, p := range pat {
+		if p[0] == '{' {
+			if labels[i] == "" {
+				return false
+			}
+			params.Add(p[1:len(p)-1], labels[i])
+			continue
+		}
+		if p != labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHost returns the lower cased host of the request, without port
+// and trailing dot.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
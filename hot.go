@@ -0,0 +1,258 @@
+package orbit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hot enables the concurrency-safe mode of the router, for routes added,
+// replaced and removed while it serves requests, e.g. by a gateway
+// loading them from config. Every change is applied to a copy of the
+// routing tree, which then atomically replaces the one requests are routed
+// with, so routing stays lock-free and never sees a partial change.
+//
+// Hot should be called before the router serves requests. Metadata set on
+// a RouteHandle after registration isn't synchronized, set it before the
+// route gets traffic.
+func (o *Orbit) Hot(enabled bool) {
+	m := o.owner()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled && !m.hot {
+		m.live.Store(m.tree)
+	}
+	if !enabled && m.hot {
+		m.tree = m.live.Load()
+	}
+	m.hot = enabled
+}
+
+// RemoveRoute removes the route registered for `method` and `pattern`,
+// comparing patterns regardless of param names. The "*" method removes
+// the route for every method. It reports whether a route was removed.
+// Without Hot mode, it must not be called while the router serves
+// requests.
+func (o *Orbit) RemoveRoute(method, pattern string) bool {
+	mt := mALL
+	if method != "*" {
+		var ok bool
+		if mt, ok = methodMap[strings.ToUpper(method)]; !ok {
+			panic(fmt.Sprintf("orbit: '%s' http method is not supported.", method))
+		}
+	}
+
+	m := o.owner()
+	defer m.lock()()
+
+	key := normalizePattern(pattern)
+	tree := m.writableTree()
+	n := tree.findPatternNode(key)
+	if n == nil || !n.removeEndpoints(mt) {
+		return false
+	}
+	m.publish(tree)
+
+	m.unregister(key, mt)
+	if n.endpoints == nil {
+		for name, p := range m.names {
+			if normalizePattern(p) == key {
+				delete(m.names, name)
+			}
+		}
+	}
+	return true
+}
+
+// ReplaceRoute registers `handler` for `method` and `pattern` in place of
+// the route registered for them, without a window where neither is served
+// in Hot mode. Strict mode doesn't consider it a duplicate.
+func (o *Orbit) ReplaceRoute(method, pattern string, handler Handler) *RouteHandle {
+	mt, ok := methodMap[strings.ToUpper(method)]
+	if !ok {
+		panic(fmt.Sprintf("orbit: '%s' http method is not supported.", method))
+	}
+
+	m := o.owner()
+	defer m.lock()()
+
+	m.unregister(normalizePattern(pattern), mt)
+	meta := &RouteMeta{}
+	o.insert(mt, pattern, &routeGuard{meta: meta, next: handler}, func(n *node) {
+		n.setMeta(mt, meta)
+	})
+	return &RouteHandle{orbit: m, pattern: pattern, meta: meta}
+}
+
+// SwapRoutes replaces every route of the router with the ones registered
+// by `fn`, which are built on a fresh router and swapped in at once. The
+// middlewares, NotFound, MethodNotAllowed and error handlers and the
+// router settings are kept. Changing them isn't safe while requests are
+// served, so SwapRoutes panics if `fn` sets any of the handlers.
+func (o *Orbit) SwapRoutes(fn func(r Router)) {
+	m := o.owner()
+
+	// The handlers are left unset, to tell whether `fn` sets them. The
+	// sub-routers it mounts get the ones of the router after.
+	next := NewOrbit()
+	next.pool = m.pool
+	next.strict = m.strict
+	next.strictReport = m.strictReport
+	next.autoHead = m.autoHead
+	next.autoOptions = m.autoOptions
+	next.pathPolicy = m.pathPolicy
+	fn(next)
+	if next.notFoundHandler != nil || next.methodNotAllowedHandler != nil || next.errorHandler != nil {
+		panic("orbit: SwapRoutes() can't change the NotFound, MethodNotAllowed or error handler, set them on the router")
+	}
+	if m.notFoundHandler != nil {
+		next.NotFound(m.notFoundHandler)
+	}
+	if m.methodNotAllowedHandler != nil {
+		next.MethodNotAllowed(m.methodNotAllowedHandler)
+	}
+
+	defer m.lock()()
+	if m.handler == nil {
+		m.updateRouteHandler()
+	}
+	m.publish(next.tree)
+	m.names = next.names
+	m.registrations = next.registrations
+}
+
+// lock locks the router for a change in Hot mode, and returns the
+// function unlocking it.
+func (o *Orbit) lock() func() {
+	if !o.hot {
+		return func() {}
+	}
+	o.mu.Lock()
+	return o.mu.Unlock
+}
+
+// rlock locks the router for reading in Hot mode, and returns the
+// function unlocking it.
+func (o *Orbit) rlock() func() {
+	if !o.hot {
+		return func() {}
+	}
+	o.mu.RLock()
+	return o.mu.RUnlock
+}
+
+// root returns the routing tree requests are routed with.
+func (o *Orbit) root() *node {
+	m := o.owner()
+	if m.hot {
+		return m.live.Load()
+	}
+	return m.tree
+}
+
+// writableTree returns the tree to apply a change to: a copy of the live
+// tree in Hot mode, or the tree itself.
+func (o *Orbit) writableTree() *node {
+	if o.hot {
+		return o.live.Load().clone()
+	}
+	return o.tree
+}
+
+// publish makes `tree` the live tree in Hot mode, compiling it first if
+// the router is frozen.
+func (o *Orbit) publish(tree *node) {
+	tree.static = nil
+	if o.frozen {
+		tree.freeze()
+	}
+	if o.hot {
+		o.live.Store(tree)
+	} else {
+		o.tree = tree
+	}
+}
+
+// unregister drops `method` from the registrations of `key`, so removed
+// and replaced routes aren't reported as duplicates.
+func (o *Orbit) unregister(key string, method methodTyp) {
+	var regs []registration
+	for _, reg := range o.registrations[key] {
+		reg.method &^= method
+		if reg.method&^mSTUB != 0 {
+			regs = append(regs, reg)
+		}
+	}
+	if len(regs) == 0 {
+		delete(o.registrations, key)
+		return
+	}
+	o.registrations[key] = regs
+}
+
+// clone returns a deep copy of the sub-tree of a node. Handlers, metadata
+// and sub-routers are shared.
+func (n *node) clone() *node {
+	c := *n
+	c.static = nil
+	if n.endpoints != nil {
+		c.endpoints = make(endpoints, len(n.endpoints))
+		for m, ep := range n.endpoints {
+			e := *ep
+			c.endpoints[m] = &e
+		}
+	}
+	for t, nds := range n.children {
+		if nds == nil {
+			continue
+		}
+		c.children[t] = make(nodes, len(nds))
+		for i, cn := range nds {
+			c.children[t][i] = cn.clone()
+		}
+	}
+	return &c
+}
+
+// findPatternNode returns the node holding the endpoints of the pattern
+// normalized as `key`.
+func (n *node) findPatternNode(key string) *node {
+	for _, ep := range n.endpoints {
+		if ep.pattern != "" && normalizePattern(ep.pattern) == key {
+			return n
+		}
+	}
+	for _, nds := range n.children {
+		for _, cn := range nds {
+			if fn := cn.findPatternNode(key); fn != nil {
+				return fn
+			}
+		}
+	}
+	return nil
+}
+
+// removeEndpoints removes the endpoint of `method`, or all of them for
+// mALL. The node stops being a leaf once no method is left. It reports
+// whether there was anything to remove.
+func (n *node) removeEndpoints(method methodTyp) bool {
+	n.frozen = false
+	if method == mALL {
+		removed := n.endpoints != nil
+		n.endpoints = nil
+		n.subroutes = nil
+		return removed
+	}
+
+	if ep := n.endpoints[method]; ep == nil || ep.handler == nil {
+		return false
+	}
+	delete(n.endpoints, method)
+	for m := range n.endpoints {
+		if m != mALL && m != mSTUB {
+			return true
+		}
+	}
+	n.endpoints = nil
+	n.subroutes = nil
+	return true
+}
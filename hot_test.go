@@ -0,0 +1,60 @@
+package orbit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Concurrent mounts on the same path in Hot mode can't both succeed.
+func TestHotMountConcurrent(t *testing.T) {
+	o := NewOrbit()
+	o.Hot(true)
+
+	var wg sync.WaitGroup
+	var panics int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if recover() != nil {
+					atomic.AddInt32(&panics, 1)
+				}
+			}()
+			o.Mount("/api", NewOrbit())
+		}()
+	}
+	wg.Wait()
+	if panics != 7 {
+		t.Errorf("%d mounts panicked, want 7", panics)
+	}
+}
+
+func TestSwapRoutesHandlers(t *testing.T) {
+	o := NewOrbit()
+	o.Hot(true)
+	o.NotFound(func(b Bits) error { return b.Text(http.StatusNotFound, "custom") })
+	o.SwapRoutes(func(r Router) {
+		r.Mount("/api", NewOrbit())
+	})
+
+	for _, path := range []string{"/missing", "/api/missing"} {
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != "custom" {
+			t.Errorf("GET %s = %q, want the router NotFound handler", path, w.Body)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SwapRoutes() dropped a NotFound handler set by fn")
+		}
+	}()
+	o.SwapRoutes(func(r Router) {
+		r.NotFound(func(b Bits) error { return nil })
+	})
+}
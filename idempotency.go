@@ -0,0 +1,411 @@
+package orbit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ IdempotencyStore = &MemoryIdempotencyStore{}
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key. Done is false while the first request is in flight.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Done        bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore keeps IdempotencyRecords for the Idempotency middleware.
+type IdempotencyStore interface {
+	// Begin atomically reserves `key` with an in-flight record and reports
+	// started=true, or returns the record already stored under `key`.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (rec *IdempotencyRecord, started bool, err error)
+
+	// Get returns the record stored under `key`, or nil.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// Complete stores the final response for a reserved `key`.
+	Complete(ctx context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error
+
+	// Release drops the reservation of `key` so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Store defaults to a new MemoryIdempotencyStore.
+	Store IdempotencyStore
+
+	// Header defaults to "Idempotency-Key".
+	Header string
+
+	// TTL is how long responses are kept for replay. Defaults to 24 hours.
+	TTL time.Duration
+
+	// Wait is how long a duplicate request waits for the first one to
+	// finish before getting a 409. Zero responds 409 right away.
+	Wait time.Duration
+
+	// Required rejects requests without a key with a 400.
+	Required bool
+
+	// MaxBodySize bounds the request body read to fingerprint the
+	// request. Defaults to 1MB; larger bodies get a 413.
+	MaxBodySize int64
+
+	// MaxResponseSize bounds the response body kept for replay. Defaults
+	// to 1MB; larger responses are sent but not stored.
+	MaxResponseSize int64
+
+	// Methods the middleware applies to. Defaults to POST and PATCH.
+	Methods []string
+}
+
+// Idempotency returns a middleware that makes retries of non-idempotent
+// requests safe. The first request with a given key runs and its response
+// is stored; replays get the stored response, concurrent duplicates wait or
+// get a 409, and reusing a key for a different request gets a 422.
+//
+// Keys are scoped to the principal and the route pattern, so attach the
+// middleware to routes with With or Group where the pattern is known. Server
+// errors (5xx) aren't stored, so the client can retry them.
+//
+// Anonymous requests share a single scope per route: any client sending the
+// same key and body gets the stored response. Without authentication, keys
+// must be random enough not to be guessed, such as UUIDv4. Set-Cookie and
+// hop-by-hop headers are never stored.
+func Idempotency(opts IdempotencyOptions) func(Handler) Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.MaxResponseSize <= 0 {
+		opts.MaxResponseSize = 1 << 20
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !contains(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ikey := r.Header.Get(opts.Header)
+			if ikey == "" {
+				if opts.Required {
+					Error(w, r, NewHTTPError(http.StatusBadRequest, "missing "+opts.Header+" header"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(ikey) > 255 {
+				Error(w, r, NewHTTPError(http.StatusBadRequest, "invalid "+opts.Header+" header"))
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodySize+1))
+			if err != nil {
+				Error(w, r, NewHTTPError(http.StatusBadRequest))
+				return
+			}
+			if int64(len(body)) > opts.MaxBodySize {
+				Error(w, r, NewHTTPError(http.StatusRequestEntityTooLarge))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := idempotencyScope(r) + "\x00" + ikey
+			fp := idempotencyFingerprint(r, body)
+
+			rec, started, err := opts.Store.Begin(r.Context(), key, fp, opts.TTL)
+			if err != nil {
+				Error(w, r, err)
+				return
+			}
+
+			if !started {
+				if rec.Fingerprint != fp {
+					Error(w, r, NewHTTPError(http.StatusUnprocessableEntity, opts.Header+" was used for a different request"))
+					return
+				}
+				if !rec.Done {
+					rec, err = waitIdempotent(r.Context(), opts.Store, key, opts.Wait)
+					if err != nil {
+						Error(w, r, err)
+						return
+					}
+					if rec == nil || !rec.Done {
+						Error(w, r, NewHTTPError(http.StatusConflict, "a request with this "+opts.Header+" is in progress"))
+						return
+					}
+				}
+				replayIdempotent(w, rec)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK, limit: opts.MaxResponseSize}
+			completed := false
+			defer func() {
+				if !completed {
+					opts.Store.Release(context.Background(), key)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+
+			if rw.status >= 500 || rw.hijacked || rw.truncated {
+				return
+			}
+			rec = &IdempotencyRecord{
+				Fingerprint: fp,
+				Done:        true,
+				Status:      rw.status,
+				Header:      replayableHeader(w.Header()),
+				Body:        rw.body.Bytes(),
+			}
+			if opts.Store.Complete(r.Context(), key, rec, opts.TTL) == nil {
+				completed = true
+			}
+		})
+	}
+}
+
+// idempotencyScope returns the scope keys are unique in: the principal,
+// method and route pattern of the request.
+func idempotencyScope(r *http.Request) string {
+	var sb strings.Builder
+	if p := PrincipalContext(r.Context()); p != nil {
+		sb.WriteString(p.Scheme)
+		sb.WriteByte(':')
+		sb.WriteString(p.Subject)
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(r.Method)
+	sb.WriteByte(' ')
+
+	pattern := ""
+	if rctx := RouteContext(r.Context()); rctx != nil {
+		pattern = rctx.RoutePattern()
+	}
+	if pattern == "" {
+		pattern = r.URL.Path
+	}
+	sb.WriteString(pattern)
+	return sb.String()
+}
+
+// idempotencyFingerprint identifies the request behind a key, so a reused
+// key with a different request can be told apart from a retry.
+func idempotencyFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, r.URL.RequestURI())
+	io.WriteString(h, "\x00")
+	io.WriteString(h, r.Header.Get("Content-Type"))
+	io.WriteString(h, "\x00")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unstoredHeaders are the response headers never replayed: cookies, which
+// belong to the client that got them, and hop-by-hop headers.
+var unstoredHeaders = []string{
+	"Set-Cookie", "Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// replayableHeader returns a copy of `h` without the unstoredHeaders.
+func replayableHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range unstoredHeaders {
+		delete(h, k)
+	}
+	return h
+}
+
+// waitIdempotent polls the store until the in-flight request for `key`
+// completes or `wait` elapses.
+func waitIdempotent(ctx context.Context, store IdempotencyStore, key string, wait time.Duration) (*IdempotencyRecord, error) {
+	if wait <= 0 {
+		return nil, nil
+	}
+	deadline := time.Now().Add(wait)
+	ticker := time.NewTicker(25 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		rec, err := store.Get(ctx, key)
+		if err != nil || rec == nil || rec.Done || time.Now().After(deadline) {
+			return rec, err
+		}
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, rec *IdempotencyRecord) {
+	for k, vs := range rec.Header {
+		w.Header()[k] = append([]string(nil), vs...)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(rec.Body)))
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recordingWriter passes a response through while keeping a copy of its
+// status and body. Once the body outgrows `limit`, the copy is dropped and
+// truncated is set.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	truncated   bool
+	limit       int64
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	if !rw.truncated {
+		if int64(rw.body.Len()+len(p)) > rw.limit {
+			rw.truncated = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recordingWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, the response can't be recorded then.
+func (rw *recordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("orbit: response writer does not support hijacking")
+	}
+	rw.hijacked = true
+	return hj.Hijack()
+}
+
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore kept in process memory.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	items     map[string]memoryIdempotencyItem
+	lastSweep time.Time
+}
+
+type memoryIdempotencyItem struct {
+	rec    IdempotencyRecord
+	expiry time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{items: map[string]memoryIdempotencyItem{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, it := range s.items {
+			if now.After(it.expiry) {
+				delete(s.items, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if it, ok := s.items[key]; ok && now.Before(it.expiry) {
+		rec := it.rec
+		return &rec, false, nil
+	}
+	rec := IdempotencyRecord{Fingerprint: fingerprint}
+	s.items[key] = memoryIdempotencyItem{rec: rec, expiry: now.Add(ttl)}
+	return &rec, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[key]
+	if !ok || time.Now().After(it.expiry) {
+		return nil, nil
+	}
+	rec := it.rec
+	return &rec, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, rec *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok {
+		return errors.New("orbit: completing an unreserved idempotency key")
+	}
+	s.items[key] = memoryIdempotencyItem{rec: *rec, expiry: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if it, ok := s.items[key]; ok && !it.rec.Done {
+		delete(s.items, key)
+	}
+	return nil
+}
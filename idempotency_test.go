@@ -0,0 +1,180 @@
+package orbit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newIdempotencyOrbit serves POST /orders through the Idempotency middleware,
+// counting the calls that reach `h`.
+func newIdempotencyOrbit(opts IdempotencyOptions, h HandlerFunc) (*Orbit, *int32) {
+	calls := new(int32)
+	o := NewOrbit()
+	o.With(Idempotency(opts)).Post("/orders", func(b Bits) error {
+		atomic.AddInt32(calls, 1)
+		return h(b)
+	})
+	return o, calls
+}
+
+func postOrder(o *Orbit, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	o, calls := newIdempotencyOrbit(IdempotencyOptions{}, func(b Bits) error {
+		http.SetCookie(b.Response(), &http.Cookie{Name: "session", Value: "secret"})
+		b.Response().Header().Set("Location", "/orders/1")
+		b.Response().WriteHeader(http.StatusCreated)
+		b.Response().Write([]byte("order 1"))
+		return nil
+	})
+
+	first := postOrder(o, "k1", `{"qty":1}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("first response = %d %v", first.Code, first.Header())
+	}
+
+	replay := postOrder(o, "k1", `{"qty":1}`)
+	if replay.Code != http.StatusCreated || replay.Body.String() != "order 1" {
+		t.Errorf("replay = %d %q, want 201 %q", replay.Code, replay.Body, "order 1")
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("Location") != "/orders/1" {
+		t.Errorf("replay headers = %v", replay.Header())
+	}
+	if c := replay.Header().Get("Set-Cookie"); c != "" {
+		t.Errorf("replay sent the first client's cookie: %s", c)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+
+	if w := postOrder(o, "k1", `{"qty":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key for another body = %d, want 422", w.Code)
+	}
+	if w := postOrder(o, "", `{"qty":1}`); w.Code != http.StatusCreated {
+		t.Errorf("request without a key = %d, want 201", w.Code)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("handler called %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		wait time.Duration
+		code int
+	}{
+		{"Conflict", 0, http.StatusConflict},
+		{"Wait", 2 * time.Second, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			o, calls := newIdempotencyOrbit(IdempotencyOptions{Wait: tt.wait}, func(b Bits) error {
+				close(started)
+				<-release
+				return b.Text(http.StatusOK, "done")
+			})
+
+			done := make(chan struct{})
+			go func() {
+				postOrder(o, "k1", "")
+				close(done)
+			}()
+			<-started
+
+			if tt.wait > 0 {
+				time.AfterFunc(50*time.Millisecond, func() { close(release) })
+			}
+			w := postOrder(o, "k1", "")
+			if tt.wait == 0 {
+				close(release)
+			}
+			<-done
+
+			if w.Code != tt.code {
+				t.Errorf("duplicate = %d, want %d", w.Code, tt.code)
+			}
+			if n := atomic.LoadInt32(calls); n != 1 {
+				t.Errorf("handler called %d times, want 1", n)
+			}
+		})
+	}
+}
+
+// Requests that fail, panic or outgrow the response limit aren't stored, so
+// they can be retried.
+func TestIdempotencyRelease(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		h    HandlerFunc
+	}{
+		{"ServerError", func(b Bits) error { return NewHTTPError(http.StatusBadGateway) }},
+		{"TooLarge", func(b Bits) error { return b.Text(http.StatusOK, strings.Repeat("x", 100)) }},
+		{"Panic", func(b Bits) error { panic("boom") }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o, calls := newIdempotencyOrbit(IdempotencyOptions{MaxResponseSize: 64}, tt.h)
+			for i := 0; i < 2; i++ {
+				func() {
+					defer func() { recover() }()
+					postOrder(o, "k1", "")
+				}()
+			}
+			if n := atomic.LoadInt32(calls); n != 2 {
+				t.Errorf("handler called %d times, want 2", n)
+			}
+		})
+	}
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	o, _ := newIdempotencyOrbit(IdempotencyOptions{Required: true, MaxBodySize: 8}, func(b Bits) error { return nil })
+	if w := postOrder(o, "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing key = %d, want 400", w.Code)
+	}
+	if w := postOrder(o, "k1", "123456789"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body = %d, want 413", w.Code)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	s := NewMemoryIdempotencyStore()
+	ctx := httptest.NewRequest("GET", "/", nil).Context()
+
+	rec, started, _ := s.Begin(ctx, "k", "fp", time.Minute)
+	if !started || rec.Done {
+		t.Fatalf("Begin() = %+v, %v; want a new reservation", rec, started)
+	}
+	if _, started, _ := s.Begin(ctx, "k", "fp", time.Minute); started {
+		t.Fatal("Begin() reserved a key twice")
+	}
+
+	s.Release(ctx, "k")
+	if rec, _ := s.Get(ctx, "k"); rec != nil {
+		t.Fatalf("Get() after Release = %+v, want nil", rec)
+	}
+
+	s.Begin(ctx, "k", "fp", time.Minute)
+	if err := s.Complete(ctx, "k", &IdempotencyRecord{Fingerprint: "fp", Done: true, Status: 201}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	s.Release(ctx, "k")
+	if rec, _ := s.Get(ctx, "k"); rec == nil || rec.Status != 201 {
+		t.Errorf("Release dropped a completed record: %+v", rec)
+	}
+	if err := s.Complete(ctx, "missing", &IdempotencyRecord{}, time.Minute); err == nil {
+		t.Error("Complete() of an unreserved key succeeded")
+	}
+}
@@ -0,0 +1,37 @@
+// Package funcinfo names the functions behind handlers and middlewares,
+// for the debug page and the generated docs.
+package funcinfo
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Lookup returns the name and source file:line of the function behind a
+// handler or middleware. Other handler types are named by their type.
+func Lookup(v interface{}) (name, file string) {
+	if v == nil {
+		return "", ""
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", v), ""
+	}
+	fn := runtime.FuncForPC(rv.Pointer())
+	if fn == nil {
+		return "", ""
+	}
+	f, line := fn.FileLine(fn.Entry())
+	return shortName(fn.Name()), fmt.Sprintf("%s:%d", f, line)
+}
+
+// shortName trims the import path off a function name, leaving the package
+// name, e.g. "orbit.Require.func1".
+func shortName(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,514 @@
+package orbit
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned for malformed tokens and bad signatures.
+	ErrTokenInvalid = errors.New("orbit: invalid token")
+
+	// ErrTokenExpired is returned for tokens past their `exp` claim.
+	ErrTokenExpired = errors.New("orbit: token is expired")
+
+	// ErrTokenNotYetValid is returned for tokens before their `nbf` claim.
+	ErrTokenNotYetValid = errors.New("orbit: token is not valid yet")
+)
+
+// JWTOptions configures the JWT middleware and JWTVerifier. At least one
+// key source must be set.
+type JWTOptions struct {
+	// Realm is advertised in the WWW-Authenticate challenge.
+	Realm string
+
+	// Issuer and Audience, when set, must match the `iss` and `aud` claims.
+	Issuer   string
+	Audience string
+
+	// Algorithms restricts the accepted `alg` header values. It defaults
+	// to HS256, RS256 and EdDSA, each still requiring a matching key.
+	Algorithms []string
+
+	// Secret is the shared HMAC key for HS256 tokens.
+	Secret []byte
+
+	// PublicKeys maps a `kid` to an *rsa.PublicKey or ed25519.PublicKey.
+	// The empty kid matches tokens without one. RSA keys must be at least
+	// 2048 bits.
+	PublicKeys map[string]crypto.PublicKey
+
+	// JWKSFile and JWKSURL load a JSON Web Key Set from a local file or
+	// an URL. The set is cached for JWKSCacheTTL, one hour by default,
+	// and refreshed early when a token names an unknown kid. RSA keys
+	// shorter than 2048 bits are ignored. While the set can't be loaded,
+	// tokens that need it are answered with a 503.
+	JWKSFile     string
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
+
+	// ClockSkew is the leeway applied to the `exp` and `nbf` claims.
+	ClockSkew time.Duration
+
+	// Principal maps verified claims to a Principal. By default, `sub`
+	// becomes the subject, the space separated `scope` (or `scp` list)
+	// the scopes, and the `roles` list the roles.
+	Principal func(claims map[string]interface{}) *Principal
+}
+
+// JWT returns a middleware that authenticates requests by a JWT bearer
+// token. It panics if the options are invalid.
+func JWT(opts JWTOptions) func(Handler) Handler {
+	v, err := NewJWTVerifier(opts)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	mapper := opts.Principal
+	if mapper == nil {
+		mapper = defaultJWTPrincipal
+	}
+	realm := fmt.Sprintf("Bearer realm=%q", opts.Realm)
+
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				Error(w, r, unauthorized(realm, nil))
+				return
+			}
+
+			claims, err := v.Verify(token)
+			if err != nil {
+				desc := tokenErrorDescription(err)
+				if desc == "" {
+					// The key set couldn't be loaded, which says nothing
+					// about the token.
+					e := NewHTTPError(http.StatusServiceUnavailable)
+					e.Err = err
+					Error(w, r, e)
+					return
+				}
+				challenge := fmt.Sprintf("%s, error=\"invalid_token\", error_description=%q", realm, desc)
+				Error(w, r, unauthorized(challenge, err))
+				return
+			}
+
+			p := mapper(claims)
+			if p == nil {
+				Error(w, r, unauthorized(realm+`, error="invalid_token"`, ErrTokenInvalid))
+				return
+			}
+			cp := *p
+			cp.Scheme = "jwt"
+			if cp.Claims == nil {
+				cp.Claims = claims
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), &cp)))
+		})
+	}
+}
+
+// tokenErrorDescription returns the error_description sent for a token
+// error, or "" if `err` isn't one. Descriptions are fixed so that no details
+// of the failure reach the client.
+func tokenErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return "token is expired"
+	case errors.Is(err, ErrTokenNotYetValid):
+		return "token is not valid yet"
+	case errors.Is(err, ErrTokenInvalid):
+		return "invalid token"
+	}
+	return ""
+}
+
+func defaultJWTPrincipal(claims map[string]interface{}) *Principal {
+	p := &Principal{}
+	p.Subject, _ = claims["sub"].(string)
+	if s, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(s)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+	p.Roles = stringList(claims["roles"])
+	return p
+}
+
+// JWTVerifier verifies JWT signatures and registered claims.
+type JWTVerifier struct {
+	opts       JWTOptions
+	algorithms []string
+	jwks       *jwksCache
+}
+
+// NewJWTVerifier returns a JWTVerifier for `opts`.
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if opts.Secret == nil && opts.PublicKeys == nil && opts.JWKSFile == "" && opts.JWKSURL == "" {
+		return nil, errors.New("orbit: JWT requires a Secret, PublicKeys or a JWKS source")
+	}
+
+	v := &JWTVerifier{opts: opts, algorithms: opts.Algorithms}
+	if len(v.algorithms) == 0 {
+		v.algorithms = []string{"HS256", "RS256", "EdDSA"}
+	}
+	for _, alg := range v.algorithms {
+		if alg != "HS256" && alg != "RS256" && alg != "EdDSA" {
+			return nil, fmt.Errorf("orbit: unsupported JWT algorithm '%s'", alg)
+		}
+	}
+	for kid, k := range opts.PublicKeys {
+		if rk, ok := k.(*rsa.PublicKey); ok && rk.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("orbit: RSA key '%s' is shorter than %d bits", kid, minRSABits)
+		}
+	}
+	if opts.JWKSFile != "" || opts.JWKSURL != "" {
+		ttl := opts.JWKSCacheTTL
+		if ttl <= 0 {
+			ttl = time.Hour
+		}
+		v.jwks = &jwksCache{file: opts.JWKSFile, url: opts.JWKSURL, ttl: ttl}
+	}
+	return v, nil
+}
+
+// Verify checks the signature and the exp, nbf, iss and aud claims of
+// `token` and returns its claims.
+func (v *JWTVerifier) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if !contains(v.algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: algorithm '%s' is not allowed", ErrTokenInvalid, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	key, err := v.key(header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig) {
+		return nil, fmt.Errorf("%w: bad signature", ErrTokenInvalid)
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	skew := v.opts.ClockSkew
+
+	exp, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if exp != nil && now.After(exp.Add(skew)) {
+		return ErrTokenExpired
+	}
+	nbf, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if nbf != nil && now.Add(skew).Before(*nbf) {
+		return ErrTokenNotYetValid
+	}
+	if v.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.opts.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrTokenInvalid)
+		}
+	}
+	if v.opts.Audience != "" {
+		aud := stringList(claims["aud"])
+		if s, ok := claims["aud"].(string); ok {
+			aud = []string{s}
+		}
+		if !contains(aud, v.opts.Audience) {
+			return fmt.Errorf("%w: unexpected audience", ErrTokenInvalid)
+		}
+	}
+	return nil
+}
+
+// numericDate returns the time of claim `name`, nil if it is absent. A
+// claim that isn't a JSON number, null included, makes the token invalid
+// rather than never expiring.
+func numericDate(claims map[string]interface{}, name string) (*time.Time, error) {
+	v, ok := claims[name]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s' is not a number", ErrTokenInvalid, name)
+	}
+	t := time.Unix(int64(n), 0)
+	return &t, nil
+}
+
+// key resolves the verification key for a token header. Keys must match
+// the algorithm type so an RSA public key can never be used as an HMAC
+// secret.
+func (v *JWTVerifier) key(alg, kid string) (interface{}, error) {
+	if alg == "HS256" && v.opts.Secret != nil {
+		return v.opts.Secret, nil
+	}
+	if k, ok := v.opts.PublicKeys[kid]; ok && keyMatchesAlg(k, alg) {
+		return k, nil
+	}
+	if v.jwks != nil {
+		k, err := v.jwks.get(kid)
+		if err != nil {
+			return nil, err
+		}
+		if k != nil && keyMatchesAlg(k, alg) {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no key for kid '%s'", ErrTokenInvalid, kid)
+}
+
+func keyMatchesAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == "HS256"
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+func verifySignature(alg string, key interface{}, signed string, sig []byte) bool {
+	switch alg {
+	case "HS256":
+		h := hmac.New(sha256.New, key.([]byte))
+		h.Write([]byte(signed))
+		return hmac.Equal(sig, h.Sum(nil))
+	case "RS256":
+		sum := sha256.Sum256([]byte(signed))
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, sum[:], sig) == nil
+	case "EdDSA":
+		return ed25519.Verify(key.(ed25519.PublicKey), []byte(signed), sig)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringList converts a JSON array of strings to a []string.
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// jwksCache loads and caches a JSON Web Key Set.
+type jwksCache struct {
+	file string
+	url  string
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetched   time.Time
+	lastForce time.Time
+
+	// loading is closed once the refresh in flight is done, nil if there
+	// is none. After failed refreshes, the next one waits until retryAt.
+	loading  chan struct{}
+	err      error
+	failures int
+	retryAt  time.Time
+}
+
+// minRSABits is the shortest RSA modulus accepted for RS256.
+const minRSABits = 2048
+
+// jwksMaxBackoff bounds the wait between failed refreshes.
+const jwksMaxBackoff = time.Minute
+
+// get returns the key `kid`. Known keys are served right away, stale ones
+// included while the set is refreshed in the background; unknown ones wait
+// for the refresh, if there is one.
+func (c *jwksCache) get(kid string) (interface{}, error) {
+	c.mu.Lock()
+	now := time.Now()
+	key, known := c.keys[kid]
+	stale := c.keys == nil || now.Sub(c.fetched) > c.ttl
+
+	// Refresh early on unknown kids, as the issuer may have rotated keys,
+	// but at most once a minute so bogus tokens can't hammer the source.
+	if !stale && !known && now.Sub(c.lastForce) > time.Minute {
+		stale = true
+		c.lastForce = now
+	}
+
+	if stale && c.loading == nil && !now.Before(c.retryAt) {
+		c.loading = make(chan struct{})
+		go c.refresh(c.loading)
+	}
+	loading := c.loading
+	c.mu.Unlock()
+
+	if known {
+		return key, nil
+	}
+	if loading != nil {
+		<-loading
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		return nil, fmt.Errorf("orbit: loading JWKS: %w", c.err)
+	}
+	return c.keys[kid], nil
+}
+
+// refresh loads the key set, keeping the current one on failure and
+// backing off exponentially before the next attempt.
+func (c *jwksCache) refresh(done chan struct{}) {
+	keys, err := c.load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if err != nil {
+		c.err = err
+		c.failures++
+		backoff := jwksMaxBackoff
+		if c.failures < 7 {
+			backoff = time.Second << (c.failures - 1)
+		}
+		c.retryAt = now.Add(backoff)
+	} else {
+		c.keys, c.fetched = keys, now
+		c.err, c.failures, c.retryAt = nil, 0, time.Time{}
+	}
+	c.loading = nil
+	close(done)
+}
+
+func (c *jwksCache) load() (map[string]interface{}, error) {
+	var b []byte
+	var err error
+	if c.file != "" {
+		b, err = os.ReadFile(c.file)
+	} else {
+		client := &http.Client{Timeout: 10 * time.Second}
+		var resp *http.Response
+		resp, err = client.Get(c.url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		b, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(b)
+}
+
+func parseJWKS(b []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				continue
+			}
+			key := &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+			if key.N.BitLen() < minRSABits {
+				continue
+			}
+			keys[k.Kid] = key
+		case "OKP":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.Kid] = ed25519.PublicKey(x)
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				continue
+			}
+			keys[k.Kid] = secret
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,234 @@
+package orbit
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testRSA    = mustRSAKey(2048)
+	testRSA2   = mustRSAKey(2048)
+	_, testEd  = mustEdKey()
+)
+
+func mustRSAKey(bits int) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func mustEdKey() (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return pub, priv
+}
+
+// signToken signs `claims` with `key`, a []byte, *rsa.PrivateKey or
+// ed25519.PrivateKey, under the header `alg` and `kid`.
+func signToken(alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		m := hmac.New(sha256.New, k)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	now := time.Now().Unix()
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&testRSA.PublicKey)
+
+	v, err := NewJWTVerifier(JWTOptions{
+		Issuer:    "https://issuer",
+		Audience:  "api",
+		Secret:    testSecret,
+		ClockSkew: time.Minute,
+		PublicKeys: map[string]crypto.PublicKey{
+			"rsa":  &testRSA.PublicKey,
+			"rsa2": &testRSA2.PublicKey,
+			"ed":   testEd.Public(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// claims returns valid claims with `kv` pairs overriding them.
+	claims := func(kv ...interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "alice", "iss": "https://issuer", "aud": "api", "exp": now + 60}
+		for i := 0; i < len(kv); i += 2 {
+			c[kv[i].(string)] = kv[i+1]
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", signToken("HS256", "", testSecret, claims()), nil},
+		{"RS256", signToken("RS256", "rsa", testRSA, claims()), nil},
+		{"EdDSA", signToken("EdDSA", "ed", testEd, claims()), nil},
+
+		// The RSA public key used as an HMAC secret.
+		{"HSWithRSAKey", signToken("HS256", "rsa", rsaDER, claims()), ErrTokenInvalid},
+		// An RS256 signature under an HS256 header.
+		{"HSWithRSASignature", signToken("HS256", "rsa", testRSA, claims()), ErrTokenInvalid},
+		{"None", signToken("none", "", nil, claims()), ErrTokenInvalid},
+		{"NoneEmptySig", strings.TrimSuffix(signToken("none", "", nil, claims()), "."), ErrTokenInvalid},
+		{"BadSignature", signToken("HS256", "", []byte("wrong"), claims()), ErrTokenInvalid},
+		{"Malformed", "a.b", ErrTokenInvalid},
+
+		{"Expired", signToken("HS256", "", testSecret, claims("exp", now-120)), ErrTokenExpired},
+		{"ExpiredWithinSkew", signToken("HS256", "", testSecret, claims("exp", now-30)), nil},
+		{"NotYetValid", signToken("HS256", "", testSecret, claims("nbf", now+120)), ErrTokenNotYetValid},
+		{"NotYetValidWithinSkew", signToken("HS256", "", testSecret, claims("nbf", now+30)), nil},
+		{"ExpString", signToken("HS256", "", testSecret, claims("exp", "0")), ErrTokenInvalid},
+		{"ExpNull", signToken("HS256", "", testSecret, claims("exp", nil)), ErrTokenInvalid},
+		{"NbfString", signToken("HS256", "", testSecret, claims("nbf", "later")), ErrTokenInvalid},
+		{"NoExp", signToken("HS256", "", testSecret, map[string]interface{}{"iss": "https://issuer", "aud": "api"}), nil},
+
+		{"WrongIssuer", signToken("HS256", "", testSecret, claims("iss", "https://other")), ErrTokenInvalid},
+		{"NoIssuer", signToken("HS256", "", testSecret, claims("iss", nil)), ErrTokenInvalid},
+		{"WrongAudience", signToken("HS256", "", testSecret, claims("aud", "web")), ErrTokenInvalid},
+		{"AudienceList", signToken("HS256", "", testSecret, claims("aud", []string{"web", "api"})), nil},
+		{"AudienceListWithout", signToken("HS256", "", testSecret, claims("aud", []string{"web"})), ErrTokenInvalid},
+
+		{"KidSelectsKey", signToken("RS256", "rsa2", testRSA2, claims()), nil},
+		{"KidOtherKey", signToken("RS256", "rsa2", testRSA, claims()), ErrTokenInvalid},
+		{"UnknownKid", signToken("RS256", "missing", testRSA, claims()), ErrTokenInvalid},
+		{"NoKid", signToken("RS256", "", testRSA, claims()), ErrTokenInvalid},
+		{"KidWrongType", signToken("EdDSA", "rsa", testEd, claims()), ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(tt.token)
+			if tt.err == nil && err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	v, err := NewJWTVerifier(JWTOptions{
+		Algorithms: []string{"RS256"},
+		Secret:     testSecret,
+		PublicKeys: map[string]crypto.PublicKey{"": &testRSA.PublicKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(signToken("HS256", "", testSecret, nil)); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("HS256 when only RS256 is allowed: %v", err)
+	}
+	if _, err := v.Verify(signToken("RS256", "", testRSA, nil)); err != nil {
+		t.Errorf("RS256: %v", err)
+	}
+
+	if _, err := NewJWTVerifier(JWTOptions{Secret: testSecret, Algorithms: []string{"none"}}); err == nil {
+		t.Error("the none algorithm was accepted")
+	}
+}
+
+func TestJWTShortRSAKey(t *testing.T) {
+	short := mustRSAKey(1024)
+	_, err := NewJWTVerifier(JWTOptions{PublicKeys: map[string]crypto.PublicKey{"": &short.PublicKey}})
+	if err == nil {
+		t.Error("a 1024 bit RSA key was accepted")
+	}
+
+	jwks := func(k *rsa.PublicKey, kid string) map[string]string {
+		return map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{"keys": []interface{}{
+		jwks(&short.PublicKey, "short"), jwks(&testRSA.PublicKey, "long"),
+	}})
+	keys, err := parseJWKS(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys["short"]; ok {
+		t.Error("a 1024 bit RSA key was loaded from the JWKS")
+	}
+	if _, ok := keys["long"]; !ok {
+		t.Error("a 2048 bit RSA key was dropped from the JWKS")
+	}
+}
+
+func TestJWTMiddlewareErrors(t *testing.T) {
+	serve := func(opts JWTOptions, token string) *httptest.ResponseRecorder {
+		o := NewOrbit()
+		o.With(JWT(opts)).Get("/", func(b Bits) error { return nil })
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, r)
+		return w
+	}
+
+	// Token errors get a fixed description, never the details.
+	w := serve(JWTOptions{Secret: testSecret}, signToken("HS256", "", testSecret, map[string]interface{}{"exp": "0"}))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); !strings.Contains(h, `error_description="invalid token"`) {
+		t.Errorf("WWW-Authenticate = %s", h)
+	}
+
+	// A key set that can't be loaded is the server's failure.
+	missing := filepath.Join(t.TempDir(), "jwks.json")
+	w = serve(JWTOptions{JWKSFile: missing}, signToken("RS256", "rsa", testRSA, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); h != "" {
+		t.Errorf("WWW-Authenticate = %s, want none", h)
+	}
+	if strings.Contains(w.Body.String(), missing) {
+		t.Errorf("the body leaks the JWKS path: %s", w.Body)
+	}
+}
@@ -0,0 +1,239 @@
+package orbit
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Matcher is a condition on a request, other than its method and path,
+// that selects between handlers registered on the same route. Matchers are
+// attached to routes with When.
+type Matcher struct {
+	// Name describes the condition in docs and route listings, e.g.
+	// "header Accept-Version: 2".
+	Name string
+
+	// Status is the response status when no handler of the route
+	// matches, usually 406 or 415.
+	Status int
+
+	Match func(r *http.Request) bool
+}
+
+// MatchHeader matches requests with header `key` set to one of `values`,
+// or set at all if no values are given. Routes whose header matchers all
+// fail respond with a 406.
+func MatchHeader(key string, values ...string) Matcher {
+	key = http.CanonicalHeaderKey(key)
+	return Matcher{
+		Name:   "header " + key + matcherValues(": ", values),
+		Status: http.StatusNotAcceptable,
+		Match: func(r *http.Request) bool {
+			vs, ok := r.Header[key]
+			if !ok {
+				return false
+			}
+			if len(values) == 0 {
+				return true
+			}
+			for _, v := range vs {
+				if contains(values, strings.TrimSpace(v)) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// MatchQuery matches requests with query parameter `key` set to one of
+// `values`, or set at all if no values are given. Routes whose query
+// matchers all fail respond with a 406.
+func MatchQuery(key string, values ...string) Matcher {
+	return Matcher{
+		Name:   "query " + key + matcherValues("=", values),
+		Status: http.StatusNotAcceptable,
+		Match: func(r *http.Request) bool {
+			vs, ok := r.URL.Query()[key]
+			if !ok {
+				return false
+			}
+			if len(values) == 0 {
+				return true
+			}
+			for _, v := range vs {
+				if contains(values, v) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// MatchContentType matches requests whose Content-Type is one of the media
+// types, ignoring parameters like charset. A media type can end in "/*" to
+// match any subtype. Routes whose content type matchers all fail respond
+// with a 415.
+func MatchContentType(mediaTypes ...string) Matcher {
+	types := make([]string, len(mediaTypes))
+	for i, mt := range mediaTypes {
+		types[i] = strings.ToLower(mt)
+	}
+	return Matcher{
+		Name:   "content-type " + strings.Join(types, ", "),
+		Status: http.StatusUnsupportedMediaType,
+		Match: func(r *http.Request) bool {
+			ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil {
+				return false
+			}
+			for _, mt := range types {
+				if mt == ct || strings.HasSuffix(mt, "/*") && strings.HasPrefix(ct, mt[:len(mt)-1]) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// MatchFunc returns a custom matcher, responding with `status` when no
+// handler of the route matches.
+func MatchFunc(name string, status int, fn func(r *http.Request) bool) Matcher {
+	return Matcher{Name: name, Status: status, Match: fn}
+}
+
+// When returns an inline router whose routes only match requests that pass
+// all the matchers. Several handlers can be registered on the same method
+// and pattern with different matchers, e.g.
+//
+//	r.When(orbit.MatchHeader("Accept-Version", "2")).Get("/users", listUsersV2)
+//	r.Get("/users", listUsers)
+//
+// Once FindRoute has picked the route, its handlers are tried in
+// registration order, the one registered without matchers last. If none
+// matches, the request fails with a 415 when only content type matchers
+// rejected it, or a 406 otherwise.
+func (o *Orbit) When(matchers ...Matcher) Router {
+	im := o.With().(*Orbit)
+	im.matchers = append(im.matchers[:len(im.matchers):len(im.matchers)], matchers...)
+	return im
+}
+
+func matcherValues(sep string, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return sep + strings.Join(values, ", ")
+}
+
+// matcherNames describes a set of matchers, used to tell handlers of the
+// same route apart.
+func matcherNames(matchers []Matcher) string {
+	names := make([]string, len(matchers))
+	for i, m := range matchers {
+		names[i] = m.Name
+	}
+	return strings.Join(names, " && ")
+}
+
+// variant is one of the handlers registered on an endpoint with When.
+type variant struct {
+	matchers []Matcher
+	when     string
+	handler  Handler
+	meta     *RouteMeta
+}
+
+// variantHandler is the handler of an endpoint that has handlers with
+// matchers. It picks the first variant whose matchers all pass.
+type variantHandler struct {
+	variants []*variant
+
+	// added is the index of the most recently registered variant, which
+	// gets the route metadata.
+	added int
+}
+
+func (vh *variantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	unsupported := true
+	for _, v := range vh.variants {
+		m := v.failed(r)
+		if m == nil {
+			if rctx := RouteContext(r.Context()); rctx != nil && v.meta != nil {
+				rctx.routeMeta = v.meta
+			}
+			v.handler.ServeHTTP(w, r)
+			return
+		}
+		if m.Status != http.StatusUnsupportedMediaType {
+			unsupported = false
+		}
+	}
+
+	code := http.StatusNotAcceptable
+	if unsupported {
+		code = http.StatusUnsupportedMediaType
+	}
+	Error(w, r, NewHTTPError(code))
+}
+
+// failed returns the first matcher rejecting the request, or nil.
+func (v *variant) failed(r *http.Request) *Matcher {
+	for i := range v.matchers {
+		if !v.matchers[i].Match(r) {
+			return &v.matchers[i]
+		}
+	}
+	return nil
+}
+
+// mergeVariants returns the handler of an endpoint after `handler` is
+// registered on it, replacing `prev` with metadata `prevMeta`. Handlers with matchers are kept side
+// by side; a handler replaces the one registered with the same matchers.
+func mergeVariants(prev Handler, prevMeta *RouteMeta, handler Handler) Handler {
+	nvh, ok := handler.(*variantHandler)
+	pvh, pok := prev.(*variantHandler)
+	if !ok && !pok {
+		return handler
+	}
+
+	var vs []*variant
+	if pok {
+		vs = append(vs, pvh.variants...)
+	} else if prev != nil {
+		vs = append(vs, &variant{handler: prev, meta: prevMeta})
+	}
+	nv := &variant{handler: handler}
+	if ok {
+		nv = nvh.variants[0]
+	}
+
+	vh := &variantHandler{added: -1}
+	for _, v := range vs {
+		if v.when == nv.when {
+			continue
+		}
+		vh.variants = append(vh.variants, v)
+	}
+	// The handler without matchers is the fallback, tried last.
+	if nv.when == "" {
+		vh.variants = append(vh.variants, nv)
+		vh.added = len(vh.variants) - 1
+		return vh
+	}
+	for i, v := range vh.variants {
+		if v.when == "" {
+			vh.variants = append(vh.variants[:i], append([]*variant{nv}, vh.variants[i:]...)...)
+			vh.added = i
+			break
+		}
+	}
+	if vh.added < 0 {
+		vh.variants = append(vh.variants, nv)
+		vh.added = len(vh.variants) - 1
+	}
+	return vh
+}
@@ -0,0 +1,140 @@
+package orbit
+
+import "fmt"
+
+// RouteMeta is metadata attached to a route at registration time, for
+// middlewares, docs and tooling to make per route decisions. Read it with
+// Context.RouteMeta at request time or from Routes and WalkRoutes.
+type RouteMeta struct {
+	Name       string
+	Summary    string
+	Tags       []string
+	Deprecated bool
+	Values     map[string]interface{}
+
+	// Request and Responses are the request and response body types
+	// declared with RouteHandle.Accepts and RouteHandle.Returns.
+	Request   interface{}
+	Responses map[int]interface{}
+
+	// Policies are checked by the router against the Principal, see
+	// RouteHandle.Authorize.
+	Policies []Policy
+}
+
+func (m *RouteMeta) policies() []Policy {
+	if m == nil {
+		return nil
+	}
+	return m.Policies
+}
+
+// HasTag reports whether the route is tagged `tag`. It is safe to call on
+// a nil *RouteMeta.
+func (m *RouteMeta) HasTag(tag string) bool {
+	return m != nil && contains(m.Tags, tag)
+}
+
+// Value returns the custom value stored under `key`, or nil. It is safe to
+// call on a nil *RouteMeta.
+func (m *RouteMeta) Value(key string) interface{} {
+	if m == nil {
+		return nil
+	}
+	return m.Values[key]
+}
+
+// RouteHandle refers to a route right after it is registered, to attach
+// metadata to it, e.g.
+//
+//	r.Get("/orders/{id}", showOrder).Name("order.show").Tags("orders")
+type RouteHandle struct {
+	orbit   *Orbit
+	pattern string
+	meta    *RouteMeta
+}
+
+// Name names the route so URLs to it can be built with Orbit.URL and
+// Bits.URLFor. Names must be unique within a router and the routers mounted
+// on it; it panics otherwise.
+func (rh *RouteHandle) Name(name string) *RouteHandle {
+	o := rh.orbit
+	defer o.lock()()
+	if _, ok := o.names[name]; ok {
+		panic(fmt.Sprintf("orbit: route name '%s' is already registered", name))
+	}
+	if o.names == nil {
+		o.names = map[string]string{}
+	}
+	o.names[name] = rh.pattern
+	rh.meta.Name = name
+	return rh
+}
+
+// Summary sets a short human readable description of the route.
+func (rh *RouteHandle) Summary(summary string) *RouteHandle {
+	rh.meta.Summary = summary
+	return rh
+}
+
+// Tags adds tags to the route.
+func (rh *RouteHandle) Tags(tags ...string) *RouteHandle {
+	rh.meta.Tags = append(rh.meta.Tags, tags...)
+	return rh
+}
+
+// Deprecated flags the route as deprecated.
+func (rh *RouteHandle) Deprecated() *RouteHandle {
+	rh.meta.Deprecated = true
+	return rh
+}
+
+// Meta stores a custom key/value on the route.
+func (rh *RouteHandle) Meta(key string, value interface{}) *RouteHandle {
+	if rh.meta.Values == nil {
+		rh.meta.Values = map[string]interface{}{}
+	}
+	rh.meta.Values[key] = value
+	return rh
+}
+
+// Require requires the principal to have been granted every scope in
+// `permissions` to be served by the route, like the Require middleware.
+func (rh *RouteHandle) Require(permissions ...string) *RouteHandle {
+	for _, perm := range permissions {
+		rh.meta.Policies = append(rh.meta.Policies, Scope(perm))
+	}
+	return rh
+}
+
+// Authorize requires every policy to pass for the route to be served, e.g.
+//
+//	r.Delete("/orders/{id}", deleteOrder).Authorize(orbit.Role("admin"))
+//
+// The router checks them right before the handler, after the middlewares
+// of the route, so authentication may be one of them. Failures get a 401
+// or a 403 like the Authorize middleware.
+func (rh *RouteHandle) Authorize(policies ...Policy) *RouteHandle {
+	rh.meta.Policies = append(rh.meta.Policies, policies...)
+	return rh
+}
+
+// route registers a handler like handle, and returns a RouteHandle to the
+// new endpoints. Inline routers share the tree of the router they were
+// created from, so their routes belong to it as well.
+func (o *Orbit) route(method methodTyp, pattern string, handler Handler) *RouteHandle {
+	meta := &RouteMeta{}
+	o.handle(method, pattern, &routeGuard{meta: meta, next: handler}, func(n *node) {
+		n.setMeta(method, meta)
+	})
+	return &RouteHandle{orbit: o.owner(), pattern: pattern, meta: meta}
+}
+
+// owner returns the non-inline router whose tree this router writes to.
+func (o *Orbit) owner() *Orbit {
+	m := o
+	for m.inline && m.parent != nil {
+		m = m.parent
+	}
+	return m
+}
@@ -0,0 +1,616 @@
+package orbit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIOptions describes the API in the generated OpenAPI document.
+type OpenAPIOptions struct {
+	Title       string
+	Version     string
+	Description string
+	Servers     []string
+
+	// Host restricts the document to the routes served for the host
+	// pattern, as registered on Hosts, and to the routes that don't
+	// depend on the host. Routers serving the same path on several hosts
+	// need a document per host.
+	Host string
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document generated from a router.
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components *openAPIComponents                      `json:"components,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas"`
+}
+
+// OpenAPISchema is the subset of JSON Schema generated for Go types.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+}
+
+// Accepts declares the type of the JSON request body of the route, used
+// when generating OpenAPI documents.
+func (rh *RouteHandle) Accepts(body interface{}) *RouteHandle {
+	rh.meta.Request = body
+	return rh
+}
+
+// Returns declares the type of the JSON response body for status `code`,
+// used when generating OpenAPI documents. `body` may be nil for responses
+// without a body.
+func (rh *RouteHandle) Returns(code int, body interface{}) *RouteHandle {
+	if rh.meta.Responses == nil {
+		rh.meta.Responses = map[int]interface{}{}
+	}
+	rh.meta.Responses[code] = body
+	return rh
+}
+
+// OpenAPI generates an OpenAPI 3.1 document describing every route of `r`,
+// mounted sub-routers included. Path parameters come from the route
+// patterns, with regexp params turned into schema patterns, and operations
+// are described by the route metadata. Routes registered with Handle are
+// described for every method. Handlers registered on the same route with
+// When are merged into one operation, whose bodies are one of theirs.
+//
+// It fails if routes of different hosts share a path and method, which
+// the document can't tell apart: set OpenAPIOptions.Host to generate a
+// document per host.
+func OpenAPI(r Routes, opts OpenAPIOptions) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: opts.Title, Version: opts.Version, Description: opts.Description},
+		Paths:   map[string]map[string]*openAPIOperation{},
+	}
+	for _, s := range opts.Servers {
+		doc.Servers = append(doc.Servers, openAPIServer{URL: s})
+	}
+	schemas := &openAPISchemas{defs: map[string]*OpenAPISchema{}, seen: map[reflect.Type]string{}}
+	hosts := map[string]string{}
+	// variants holds the matchers of the handlers merged into each
+	// operation, empty for a handler without any.
+	variants := map[*openAPIOperation][]string{}
+
+	err := WalkRoutes(r, func(ri RouteInfo) error {
+		method := strings.ToLower(ri.Method)
+		if !isOpenAPIMethod(method) || (opts.Host != "" && ri.Host != "" && ri.Host != opts.Host) {
+			return nil
+		}
+
+		path, params := openAPIPath(ri.Route)
+		key := method + " " + path
+		if host, ok := hosts[key]; ok && host != ri.Host {
+			return fmt.Errorf("orbit: %s %s is served on hosts '%s' and '%s', generate a document per host with OpenAPIOptions.Host", ri.Method, path, host, ri.Host)
+		}
+		hosts[key] = ri.Host
+
+		op := &openAPIOperation{Parameters: params, Responses: map[string]*openAPIResponse{}}
+
+		if m := ri.Meta; m != nil {
+			op.OperationID = m.Name
+			op.Summary = m.Summary
+			op.Tags = m.Tags
+			op.Deprecated = m.Deprecated
+			if m.Request != nil {
+				op.RequestBody = &openAPIRequestBody{
+					Required: true,
+					Content:  map[string]openAPIMediaType{"application/json": {Schema: schemas.of(reflect.TypeOf(m.Request))}},
+				}
+			}
+			for code, body := range m.Responses {
+				resp := &openAPIResponse{Description: http.StatusText(code)}
+				if body != nil {
+					resp.Content = map[string]openAPIMediaType{"application/json": {Schema: schemas.of(reflect.TypeOf(body))}}
+				}
+				op.Responses[strconv.Itoa(code)] = resp
+			}
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["default"] = &openAPIResponse{Description: "Default response"}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		if prev := doc.Paths[path][method]; prev != nil {
+			op = mergeOperations(prev, op)
+		}
+		doc.Paths[path][method] = op
+		variants[op] = append(variants[op], strings.Join(ri.Matchers, " and "))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for op, whens := range variants {
+		op.Description = variantsDescription(whens)
+	}
+	uniqueOperationIDs(doc)
+
+	if len(schemas.defs) > 0 {
+		doc.Components = &openAPIComponents{Schemas: schemas.defs}
+	}
+	return doc, nil
+}
+
+// JSON returns the document as indented JSON.
+func (d *OpenAPIDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// YAML returns the document as YAML.
+func (d *OpenAPIDocument) YAML() ([]byte, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(b)
+}
+
+// WriteFile writes the document to `path`, as YAML for .yaml and .yml
+// files and as JSON otherwise. It's meant for checking the document into
+// a repository and diffing it in CI.
+func (d *OpenAPIDocument) WriteFile(path string) error {
+	var b []byte
+	var err error
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		b, err = d.YAML()
+	default:
+		b, err = d.JSON()
+		b = append(b, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// OpenAPIHandler returns a handler serving the OpenAPI document of `r`, as
+// YAML when requested with ?format=yaml and as JSON otherwise, e.g.
+//
+//	o.Get("/openapi.json", orbit.OpenAPIHandler(o, opts))
+//
+// The document is generated on the first request, once every route has
+// been registered.
+func OpenAPIHandler(r Routes, opts OpenAPIOptions) HandlerFunc {
+	var once sync.Once
+	var jsonDoc, yamlDoc []byte
+	var genErr error
+
+	return func(b Bits) error {
+		once.Do(func() {
+			var doc *OpenAPIDocument
+			if doc, genErr = OpenAPI(r, opts); genErr != nil {
+				return
+			}
+			if jsonDoc, genErr = doc.JSON(); genErr != nil {
+				return
+			}
+			yamlDoc, genErr = doc.YAML()
+		})
+		if genErr != nil {
+			return genErr
+		}
+
+		w := b.Response()
+		if b.Request().URL.Query().Get("format") == "yaml" {
+			w.Header().Set("Content-Type", "application/yaml")
+			_, err := w.Write(yamlDoc)
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write(jsonDoc)
+		return err
+	}
+}
+
+// mergeOperations merges the operations of the handlers registered on the
+// same route with When, into `a`.
+func mergeOperations(a, b *openAPIOperation) *openAPIOperation {
+	if a.OperationID == "" {
+		a.OperationID = b.OperationID
+	}
+	if a.Summary == "" {
+		a.Summary = b.Summary
+	}
+	for _, tag := range b.Tags {
+		if !contains(a.Tags, tag) {
+			a.Tags = append(a.Tags, tag)
+		}
+	}
+	a.Deprecated = a.Deprecated && b.Deprecated
+
+	if b.RequestBody != nil {
+		if a.RequestBody == nil {
+			a.RequestBody = b.RequestBody
+		} else {
+			mergeContent(a.RequestBody.Content, b.RequestBody.Content)
+		}
+	}
+	if _, ok := a.Responses["default"]; ok && len(b.Responses) > 0 && b.Responses["default"] == nil {
+		delete(a.Responses, "default")
+	}
+	for code, resp := range b.Responses {
+		prev := a.Responses[code]
+		switch {
+		case prev == nil:
+			if code != "default" || len(a.Responses) == 0 {
+				a.Responses[code] = resp
+			}
+		case prev.Content == nil:
+			prev.Content = resp.Content
+		case resp.Content != nil:
+			mergeContent(prev.Content, resp.Content)
+		}
+	}
+	return a
+}
+
+// uniqueOperationIDs suffixes the IDs shared by several operations, e.g.
+// those of a route registered with Handle, with their method.
+func uniqueOperationIDs(doc *OpenAPIDocument) {
+	ops := map[string][]string{}
+	for _, item := range doc.Paths {
+		for method, op := range item {
+			if op.OperationID != "" {
+				ops[op.OperationID] = append(ops[op.OperationID], method)
+			}
+		}
+	}
+	for _, item := range doc.Paths {
+		for method, op := range item {
+			if len(ops[op.OperationID]) > 1 {
+				op.OperationID += "_" + method
+			}
+		}
+	}
+}
+
+// variantsDescription describes the handlers of an operation by their
+// matchers, in the order they are tried. It is empty for an operation
+// served by a single handler without matchers.
+func variantsDescription(whens []string) string {
+	var lines []string
+	for _, when := range whens {
+		if when != "" {
+			lines = append(lines, "- when "+when)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	if len(lines) < len(whens) {
+		lines = append(lines, "- otherwise, the default handler")
+	}
+	return "Served by a handler depending on the request:\n" + strings.Join(lines, "\n")
+}
+
+// mergeContent adds the schemas of `b` to `a`, as one of the schemas of a
+// media type when they differ.
+func mergeContent(a, b map[string]openAPIMediaType) {
+	for mt, m := range b {
+		prev, ok := a[mt]
+		if !ok {
+			a[mt] = m
+			continue
+		}
+		if reflect.DeepEqual(prev.Schema, m.Schema) {
+			continue
+		}
+		if prev.Schema.OneOf == nil {
+			prev.Schema = &OpenAPISchema{OneOf: []*OpenAPISchema{prev.Schema}}
+		}
+		prev.Schema.OneOf = append(prev.Schema.OneOf, m.Schema)
+		a[mt] = prev
+	}
+}
+
+func isOpenAPIMethod(method string) bool {
+	switch method {
+	case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		return true
+	}
+	return false
+}
+
+// openAPIPath converts a route pattern to an OpenAPI path template and
+// its path parameters. The catch-all is exposed as a "wildcard" param.
+func openAPIPath(route string) (string, []openAPIParameter) {
+	var sb strings.Builder
+	var params []openAPIParameter
+
+	pat := route
+	for {
+		typ, key, rexpat, _, ps, pe := patNextSegment(pat)
+		if typ == ntStatic {
+			sb.WriteString(pat)
+			break
+		}
+		sb.WriteString(pat[:ps])
+
+		schema := &OpenAPISchema{Type: "string"}
+		if typ == ntCatchAll {
+			key = "wildcard"
+		}
+		if typ == ntRegexp {
+			schema.Pattern = rexpat
+		}
+		sb.WriteString("{" + key + "}")
+		params = append(params, openAPIParameter{Name: key, In: "path", Required: true, Schema: schema})
+		pat = pat[pe:]
+	}
+	return sb.String(), params
+}
+
+// openAPISchemas builds schemas for Go types, collecting named structs as
+// reusable components.
+type openAPISchemas struct {
+	defs map[string]*OpenAPISchema
+	seen map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *openAPISchemas) of(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name, ok := s.seen[t]
+		if !ok {
+			name = s.componentName(t)
+			s.seen[t] = name
+			s.defs[name] = s.object(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		return s.object(t)
+	}
+	return &OpenAPISchema{}
+}
+
+// object describes a struct by its JSON encoding. Fields without
+// `omitempty` are required.
+func (s *openAPISchemas) object(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := s.object(embedded)
+				for k, v := range inner.Properties {
+					schema.Properties[k] = v
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema.Properties[name] = s.of(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// componentName returns a unique component name for a named type,
+// qualifying it with its package on collisions.
+func (s *openAPISchemas) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := s.defs[name]; !taken {
+		return name
+	}
+	return strings.NewReplacer("/", "_", ".", "_").Replace(t.PkgPath()) + "_" + name
+}
+
+// jsonToYAML converts a JSON document to the equivalent block style YAML,
+// keeping the order of object keys.
+func jsonToYAML(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := yamlValue(dec, &buf, 0, false); err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(buf.Bytes(), []byte("\n")), nil
+}
+
+func yamlValue(dec *json.Decoder, w *bytes.Buffer, indent int, inSeq bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	pad := strings.Repeat("  ", indent)
+	switch t := tok.(type) {
+	case json.Delim:
+		empty := !dec.More()
+		if t == '{' {
+			if empty {
+				w.WriteString(yamlSep(inSeq) + "{}\n")
+				dec.Token()
+				return nil
+			}
+			if !inSeq {
+				w.WriteByte('\n')
+			}
+			first := true
+			for dec.More() {
+				ktok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if !(inSeq && first) {
+					w.WriteString(pad)
+				}
+				first = false
+				w.WriteString(yamlString(ktok.(string)) + ":")
+				if err := yamlValue(dec, w, indent+1, false); err != nil {
+					return err
+				}
+			}
+		} else {
+			if empty {
+				w.WriteString(yamlSep(inSeq) + "[]\n")
+				dec.Token()
+				return nil
+			}
+			w.WriteByte('\n')
+			for dec.More() {
+				w.WriteString(pad + "- ")
+				if err := yamlValue(dec, w, indent+1, true); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := dec.Token()
+		return err
+	case string:
+		w.WriteString(yamlSep(inSeq) + yamlString(t) + "\n")
+	case json.Number:
+		w.WriteString(yamlSep(inSeq) + t.String() + "\n")
+	case bool:
+		w.WriteString(yamlSep(inSeq) + strconv.FormatBool(t) + "\n")
+	case nil:
+		w.WriteString(yamlSep(inSeq) + "null\n")
+	default:
+		return fmt.Errorf("orbit: unexpected JSON token %v", tok)
+	}
+	return nil
+}
+
+func yamlSep(inSeq bool) string {
+	if inSeq {
+		return ""
+	}
+	return " "
+}
+
+// yamlString quotes strings that YAML would otherwise read as something
+// else. JSON string escaping is valid in double quoted YAML scalars.
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t\\") ||
+		strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		q, _ := json.Marshal(s)
+		return string(q)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "null", "yes", "no", "on", "off", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
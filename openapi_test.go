@@ -0,0 +1,84 @@
+package orbit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type orderV1 struct {
+	ID int `json:"id"`
+}
+
+type orderV2 struct {
+	ID   string `json:"id"`
+	Note string `json:"note,omitempty"`
+}
+
+// Handlers registered with When on the same route make a single operation.
+func TestOpenAPIVariants(t *testing.T) {
+	h := func(b Bits) error { return nil }
+	o := NewOrbit()
+	o.When(MatchHeader("Accept-Version", "2")).Get("/orders", h).Name("listOrdersV2").Returns(200, []orderV2{})
+	o.Get("/orders", h).Name("listOrders").Returns(200, []orderV1{}).Returns(404, nil)
+
+	doc, err := OpenAPI(o, OpenAPIOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.Paths["/orders"]["get"]
+	if op == nil {
+		t.Fatal("GET /orders is missing")
+	}
+	if !strings.Contains(op.Description, "when header Accept-Version: 2") || !strings.Contains(op.Description, "otherwise") {
+		t.Errorf("description = %q", op.Description)
+	}
+	if op.Responses["404"] == nil {
+		t.Error("the 404 response of a variant is missing")
+	}
+	schema := op.Responses["200"].Content["application/json"].Schema
+	if len(schema.OneOf) != 2 {
+		t.Errorf("200 schema = %+v, want one of both variants", schema)
+	}
+}
+
+func TestOpenAPIHosts(t *testing.T) {
+	h := func(b Bits) error { return nil }
+	api, admin := NewOrbit(), NewOrbit()
+	api.Get("/status", h).Name("apiStatus")
+	admin.Get("/status", h).Name("adminStatus")
+	admin.Delete("/cache", h)
+	hosts := NewHosts()
+	hosts.Host("api.example.com", api)
+	hosts.Host("admin.example.com", admin)
+
+	if _, err := OpenAPI(hosts, OpenAPIOptions{}); err == nil {
+		t.Error("OpenAPI() merged routes of different hosts")
+	}
+
+	doc, err := OpenAPI(hosts, OpenAPIOptions{Host: "admin.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := doc.Paths["/status"]["get"]; op == nil || op.OperationID != "adminStatus" {
+		t.Errorf("GET /status = %+v, want the admin route", op)
+	}
+	if doc.Paths["/cache"]["delete"] == nil {
+		t.Error("DELETE /cache is missing")
+	}
+}
+
+func TestOpenAPIHandle(t *testing.T) {
+	o := NewOrbit()
+	o.Handle("/webhook", http.NotFoundHandler()).Name("webhook")
+
+	doc, err := OpenAPI(o, OpenAPIOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"get", "post", "put", "patch", "delete"} {
+		if op := doc.Paths["/webhook"][method]; op == nil || op.OperationID != "webhook_"+method {
+			t.Errorf("%s /webhook = %+v", method, op)
+		}
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 var _ Router = &Orbit{}
@@ -16,9 +21,30 @@ type Handler interface {
 
 type HandlerFunc func(b Bits) error
 
+// bitsPool reuses the Bits handed to handlers, which are only valid until
+// the handler returns.
+var bitsPool = sync.Pool{
+	New: func() interface{} {
+		return &bits{}
+	},
+}
+
 func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	b := &bits{response: w, request: r}
-	f(b)
+	b := bitsPool.Get().(*bits)
+	b.response, b.request = w, r
+	err := f(b)
+	if b.sse != nil {
+		// The response is the event stream: it is stopped before anything
+		// else touches it, and errors can't be sent on it anymore.
+		b.sse.close()
+		if err != nil {
+			b.sse.handlerError(r, err)
+		}
+	} else if err != nil {
+		handleError(b, err)
+	}
+	*b = bits{}
+	bitsPool.Put(b)
 }
 
 // Top level application struct
@@ -29,7 +55,21 @@ type Orbit struct {
 	parent                  *Orbit
 	pool                    *sync.Pool
 	notFoundHandler         HandlerFunc
+	errorHandler            ErrorHandlerFunc
+	names                   map[string]string
+	registrations           map[string][]registration
+	strict                  bool
+	strictReport            func(RouteReport)
+	autoHead                bool
+	autoOptions             bool
+	pathPolicy              *PathPolicy
+	hot                     bool
+	frozen                  bool
+	live                    atomic.Pointer[node]
+	mu                      sync.RWMutex
+	matchers                []Matcher
 	middlewares             []func(Handler) Handler
+	policies                []Policy
 	inline                  bool
 }
 
@@ -42,10 +82,50 @@ func NewOrbit() *Orbit {
 	return o
 }
 
-// Starts the server with http.ListenAndServe
+// Starts the server, once the routes are frozen, until the process gets
+// SIGINT or SIGTERM. It then shuts the server down gracefully: in-flight
+// requests get up to 10 seconds to complete, event streams are ended and
+// WebSocket connections closed with 1001 Going Away. A second signal kills
+// the process.
 func (o *Orbit) Launch(address string) error {
+	o.Freeze()
+	return launch(address, o)
+}
+
+// shutdownTimeout bounds the graceful shutdown of the server started by
+// Launch.
+const shutdownTimeout = 10 * time.Second
+
+// launch serves `h` on `address` until the process gets SIGINT or SIGTERM,
+// then shuts the server down gracefully, see Orbit.Launch.
+func launch(address string, h http.Handler) error {
 	fmt.Printf("💫 Orbit launching: %s 🪐\n", address)
-	return http.ListenAndServe(address, o)
+	srv := &http.Server{Addr: address, Handler: h}
+	reg := registry(srv)
+	defer reg.forget()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process.
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if werr := reg.wait(ctx); err == nil {
+		err = werr
+	}
+	return err
 }
 
 // ServeHTTP is the single method of the http.Handler interface that makes
@@ -66,11 +146,11 @@ func (o *Orbit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rctx = o.pool.Get().(*Context)
 	rctx.Reset()
 	rctx.Routes = o
-	rctx.parentCtx = r.Context()
 
-	r = r.WithContext(context.WithValue(r.Context(), RouteCtxKey, rctx))
+	r, rc := withRouteContext(r, rctx)
 
 	o.handler.ServeHTTP(w, r)
+	rc.release()
 	o.pool.Put(rctx)
 }
 
@@ -84,127 +164,128 @@ func (o *Orbit) Use(middlewares ...func(Handler) Handler) {
 
 // Handle adds the route `pattern` that matches any http method to
 // execute the `handler` http.Handler.
-func (o *Orbit) Handle(pattern string, handler Handler) {
-	o.handle(mALL, pattern, handler)
+func (o *Orbit) Handle(pattern string, handler Handler) *RouteHandle {
+	return o.route(mALL, pattern, handler)
 }
 
 // HandleFunc adds the route `pattern` that matches any http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) HandleFunc(pattern string, handlerFn HandlerFunc) {
-	o.handle(mALL, pattern, handlerFn)
+func (o *Orbit) HandleFunc(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mALL, pattern, handlerFn)
 }
 
 // Method adds the route `pattern` that matches `method` http method to
 // execute the `handler` http.Handler.
-func (o *Orbit) Method(method, pattern string, handler Handler) {
+func (o *Orbit) Method(method, pattern string, handler Handler) *RouteHandle {
 	m, ok := methodMap[strings.ToUpper(method)]
 	if !ok {
 		panic(fmt.Sprintf("orbit: '%s' http method is not supported.", method))
 	}
-	o.handle(m, pattern, handler)
+	return o.route(m, pattern, handler)
 }
 
 // MethodFunc adds the route `pattern` that matches `method` http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) MethodFunc(method, pattern string, handlerFn HandlerFunc) {
-	o.Method(method, pattern, handlerFn)
+func (o *Orbit) MethodFunc(method, pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.Method(method, pattern, handlerFn)
 }
 
 // Connect adds the route `pattern` that matches a CONNECT http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Connect(pattern string, handlerFn HandlerFunc) {
-	o.handle(mCONNECT, pattern, handlerFn)
+func (o *Orbit) Connect(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mCONNECT, pattern, handlerFn)
 }
 
 // Delete adds the route `pattern` that matches a DELETE http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Delete(pattern string, handlerFn HandlerFunc) {
-	o.handle(mDELETE, pattern, handlerFn)
+func (o *Orbit) Delete(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mDELETE, pattern, handlerFn)
 }
 
 // Get adds the route `pattern` that matches a GET http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Get(pattern string, handlerFn HandlerFunc) {
-	o.handle(mGET, pattern, handlerFn)
+func (o *Orbit) Get(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mGET, pattern, handlerFn)
 }
 
 // Head adds the route `pattern` that matches a HEAD http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Head(pattern string, handlerFn HandlerFunc) {
-	o.handle(mHEAD, pattern, handlerFn)
+func (o *Orbit) Head(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mHEAD, pattern, handlerFn)
 }
 
 // Options adds the route `pattern` that matches an OPTIONS http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Options(pattern string, handlerFn HandlerFunc) {
-	o.handle(mOPTIONS, pattern, handlerFn)
+func (o *Orbit) Options(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mOPTIONS, pattern, handlerFn)
 }
 
 // Patch adds the route `pattern` that matches a PATCH http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Patch(pattern string, handlerFn HandlerFunc) {
-	o.handle(mPATCH, pattern, handlerFn)
+func (o *Orbit) Patch(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mPATCH, pattern, handlerFn)
 }
 
 // Post adds the route `pattern` that matches a POST http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Post(pattern string, handlerFn HandlerFunc) {
-	o.handle(mPOST, pattern, handlerFn)
+func (o *Orbit) Post(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mPOST, pattern, handlerFn)
 }
 
 // Put adds the route `pattern` that matches a PUT http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Put(pattern string, handlerFn HandlerFunc) {
-	o.handle(mPUT, pattern, handlerFn)
+func (o *Orbit) Put(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mPUT, pattern, handlerFn)
 }
 
 // Trace adds the route `pattern` that matches a TRACE http method to
 // execute the `handlerFn` http.HandlerFunc.
-func (o *Orbit) Trace(pattern string, handlerFn HandlerFunc) {
-	o.handle(mTRACE, pattern, handlerFn)
+func (o *Orbit) Trace(pattern string, handlerFn HandlerFunc) *RouteHandle {
+	return o.route(mTRACE, pattern, handlerFn)
 }
 
-// TODO
 // NotFound sets a custom http.HandlerFunc for routing paths that could
-// not be found. The default 404 handler is `http.NotFound`.
+// not be found. The default 404 handler is `http.NotFound`. Errors it
+// returns go to the error handler. It panics on an inline router, e.g.
+// inside a Group, whose handler would replace the one of the whole router:
+// a 404 handler of its own is set on a sub-router with Route or Mount, and
+// one running through middlewares gets them from Use.
 func (o *Orbit) NotFound(handlerFn HandlerFunc) {
-	m := o
-	hFn := handlerFn
-
-	if o.inline && o.parent != nil {
-		m = o.parent
-		// hFn = Chain(o.middlewares...).HandlerFunc(hFn).ServeHTTP
-	}
+	o.checkNotInline("NotFound")
+	m := o.owner()
 
 	// Update the notFoundHandler from this point forward
-	m.notFoundHandler = hFn
+	m.notFoundHandler = handlerFn
 	m.updateSubRoutes(func(subMux *Orbit) {
 		if subMux.notFoundHandler == nil {
-			subMux.NotFound(hFn)
+			subMux.NotFound(handlerFn)
 		}
 	})
 }
 
-// TODO
 // MethodNotAllowed sets a custom http.HandlerFunc for routing paths where the
 // method is unresolved. The default handler returns a 405 with an empty body.
+// Like NotFound, it panics on an inline router.
 func (o *Orbit) MethodNotAllowed(handlerFn HandlerFunc) {
-	// Build MethodNotAllowed handler chain
-	m := o
-	hFn := handlerFn
-	if o.inline && o.parent != nil {
-		m = o.parent
-		// hFn = Chain(o.middlewares...).HandlerFunc(hFn).ServeHTTP
-	}
+	o.checkNotInline("MethodNotAllowed")
+	m := o.owner()
 
-	m.methodNotAllowedHandler = hFn
+	m.methodNotAllowedHandler = handlerFn
 	m.updateSubRoutes(func(subMux *Orbit) {
 		if subMux.methodNotAllowedHandler == nil {
-			subMux.MethodNotAllowed(hFn)
+			subMux.MethodNotAllowed(handlerFn)
 		}
 	})
 }
 
+// checkNotInline panics if `o` is an inline router, on which the router
+// wide handler set by `method` can't be scoped.
+func (o *Orbit) checkNotInline(method string) {
+	if o.inline {
+		panic(fmt.Sprintf("orbit: %s() on a Group or With router would apply to the whole router, use Route() or Mount() for a sub-router", method))
+	}
+}
+
 // With adds inline middlewares for an endpoint handler.
 func (o *Orbit) With(middlewares ...func(Handler) Handler) Router {
 	if !o.inline && o.handler == nil {
@@ -219,9 +300,12 @@ func (o *Orbit) With(middlewares ...func(Handler) Handler) Router {
 	mws = append(mws, middlewares...)
 
 	im := &Orbit{
-		pool: o.pool, inline: true, parent: o, tree: o.tree, middlewares: mws,
+		pool: o.pool, inline: true, parent: o, middlewares: mws,
 		notFoundHandler: o.notFoundHandler, methodNotAllowedHandler: o.methodNotAllowedHandler,
 	}
+	if o.inline {
+		im.matchers = o.matchers
+	}
 
 	return im
 }
@@ -261,9 +345,8 @@ func (o *Orbit) Mount(pattern string, handler Handler) {
 	if handler == nil {
 		panic(fmt.Sprintf("orbit: attempting to Mount() a nil handler on '%s'", pattern))
 	}
-
-	if o.tree.findPattern(pattern+"*") || o.tree.findPattern(pattern+"/*") {
-		panic(fmt.Sprintf("orbit: attempting to Mount() a handler on an existing path, '%s'", pattern))
+	if v, ok := handler.(*Versions); ok {
+		v.checkDefault()
 	}
 
 	subr, ok := handler.(*Orbit)
@@ -288,28 +371,63 @@ func (o *Orbit) Mount(pattern string, handler Handler) {
 		return nil
 	})
 
-	if pattern == "" || pattern[len(pattern)-1] != '/' {
-		o.handle(mALL|mSTUB, pattern, mountHandler)
-		o.handle(mALL|mSTUB, pattern+"/", mountHandler)
-		pattern += "/"
-	}
-
 	method := mALL
 	subroutes, _ := handler.(Routes)
 	if subroutes != nil {
 		method |= mSTUB
 	}
-	n := o.handle(method, pattern+"*", mountHandler)
 
-	if subroutes != nil {
-		n.subroutes = subroutes
+	// Check for an existing mount and insert the new one under a single
+	// lock, so that two concurrent mounts in Hot mode can't both pass the
+	// check. The live tree is the one the insertions copy while locked.
+	unlock := o.owner().lock()
+	if tree := o.root(); tree.findPattern(pattern+"*") || tree.findPattern(pattern+"/*") {
+		unlock()
+		panic(fmt.Sprintf("orbit: attempting to Mount() a handler on an existing path, '%s'", pattern))
+	}
+	func() {
+		defer unlock()
+		if pattern == "" || pattern[len(pattern)-1] != '/' {
+			o.insert(mALL|mSTUB, pattern, mountHandler, nil)
+			o.insert(mALL|mSTUB, pattern+"/", mountHandler, nil)
+			pattern += "/"
+		}
+		o.insert(method, pattern+"*", mountHandler, func(n *node) {
+			if subroutes != nil {
+				n.subroutes = subroutes
+			}
+		})
+	}()
+
+	// Strict mode carries over to sub-routers, whose routes are checked
+	// once now that they are part of the tree.
+	if ok && o.owner().strict {
+		subr.strict = true
+		subr.strictReport = o.owner().strictReport
+		subr.checkStrictReport(strings.TrimSuffix(pattern, "/"))
+	}
+
+	if ok && o.owner().autoHead {
+		subr.AutoHead(true)
+	}
+	if ok && o.owner().autoOptions {
+		subr.AutoOptions(true)
+	}
+	if ok && subr.pathPolicy == nil && o.owner().pathPolicy != nil {
+		subr.PathPolicy(*o.owner().pathPolicy)
+	}
+
+	if ok {
+		unlock := o.owner().rlock()
+		defer unlock()
+		o.owner().checkNames()
 	}
 }
 
 // Routes returns a slice of routing information from the tree,
 // useful for traversing available routes of a router.
 func (o *Orbit) Routes() []Route {
-	return o.tree.routes()
+	return o.root().routes()
 }
 
 // Middlewares returns a slice of middleware handler functions.
@@ -326,7 +444,8 @@ func (o *Orbit) Match(rctx *Context, method, path string) bool {
 		return false
 	}
 
-	node, _, h := o.tree.FindRoute(rctx, m, path)
+	rctx.foldCase = o.pathPolicy != nil && o.pathPolicy.CaseInsensitive
+	node, _, h := o.root().FindRoute(rctx, m, path)
 
 	if node != nil && node.subroutes != nil {
 		rctx.RoutePath = o.nextRoutePath(rctx)
@@ -342,7 +461,6 @@ func (o *Orbit) NotFoundHandler() HandlerFunc {
 	if o.notFoundHandler != nil {
 		return o.notFoundHandler
 	}
-	// TODO
 	return func(b Bits) error {
 		http.Error(b.Response(), "404 page not found", http.StatusNotFound)
 		return nil
@@ -359,8 +477,15 @@ func (o *Orbit) MethodNotAllowedHandler(methodsAllowed ...methodTyp) HandlerFunc
 }
 
 // handle registers a http.Handler in the routing tree for a particular http method
-// and routing pattern.
-func (o *Orbit) handle(method methodTyp, pattern string, handler http.Handler) *node {
+// and routing pattern. `setup`, if not nil, is called with the node of the route
+// before the change is published in Hot mode.
+func (o *Orbit) handle(method methodTyp, pattern string, handler http.Handler, setup func(n *node)) *node {
+	defer o.owner().lock()()
+	return o.insert(method, pattern, handler, setup)
+}
+
+// insert is handle for a locked router.
+func (o *Orbit) insert(method methodTyp, pattern string, handler http.Handler, setup func(n *node)) *node {
 	if len(pattern) == 0 || pattern[0] != '/' {
 		panic(fmt.Sprintf("orbit: routing pattern must begin with '/' in '%s'", pattern))
 	}
@@ -376,7 +501,28 @@ func (o *Orbit) handle(method methodTyp, pattern string, handler http.Handler) *
 	} else {
 		h = handler
 	}
-	return o.tree.InsertRoute(method, pattern, h)
+
+	when := ""
+	if len(o.matchers) > 0 {
+		when = matcherNames(o.matchers)
+		h = &variantHandler{variants: []*variant{{matchers: o.matchers, when: when, handler: h}}}
+	}
+
+	// Check the registration before recording it, so that a rejected
+	// route isn't reported as a duplicate later on.
+	o.checkStrict(o.duplicate(method, pattern, when))
+	m := o.owner()
+	tree := m.writableTree()
+	n := tree.InsertRoute(method, pattern, h)
+	if setup != nil {
+		setup(n)
+	}
+	// Check the tree before it goes live, so that in Hot mode a rejected
+	// route is never served.
+	o.checkStrictRoute(tree, pattern)
+	o.register(method, pattern, when)
+	m.publish(tree)
+	return n
 }
 
 // routeHTTP routes a http.Request through the Orbit routing tree to serve
@@ -405,11 +551,22 @@ func (o *Orbit) routeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, _, h := o.tree.FindRoute(rctx, method, routePath); h != nil {
+	if o.cleanRoutePath(w, r, routePath) {
+		return
+	}
+	rctx.foldCase = o.pathPolicy != nil && o.pathPolicy.CaseInsensitive
+
+	if _, _, h := o.root().FindRoute(rctx, method, routePath); h != nil {
 		h.ServeHTTP(w, r)
 		return
 	}
+	if !rctx.methodNotAllowed && o.trailingSlash(w, r, rctx, method, routePath) {
+		return
+	}
 	if rctx.methodNotAllowed {
+		if o.autoMethod(w, r, rctx, method, routePath) {
+			return
+		}
 		o.MethodNotAllowedHandler(rctx.methodsAllowed...).ServeHTTP(w, r)
 	} else {
 		o.NotFoundHandler().ServeHTTP(w, r)
@@ -427,7 +584,7 @@ func (o *Orbit) nextRoutePath(rctx *Context) string {
 
 // Recursively update data on child routers.
 func (o *Orbit) updateSubRoutes(fn func(subMux *Orbit)) {
-	for _, r := range o.tree.routes() {
+	for _, r := range o.root().routes() {
 		subMux, ok := r.SubRoutes.(*Orbit)
 		if !ok {
 			continue
@@ -441,7 +598,7 @@ func (o *Orbit) updateSubRoutes(fn func(subMux *Orbit)) {
 // point, no other middlewares can be registered on this Orbit's stack. But you can still
 // compose additional middlewares via Group()'s or using a chained middleware handler.
 func (o *Orbit) updateRouteHandler() {
-	o.handler = chain(o.middlewares, http.HandlerFunc(o.routeHTTP))
+	o.handler, o.policies = chain(o.middlewares, http.HandlerFunc(o.routeHTTP))
 }
 
 // methodNotAllowedHandler is a helper function to respond with a 405,
@@ -0,0 +1,180 @@
+package orbit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// discardWriter is a ResponseWriter that doesn't allocate.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func newBenchOrbit() *Orbit {
+	o := NewOrbit()
+	h := func(b Bits) error { return nil }
+	o.Get("/", h)
+	o.Get("/users", h)
+	o.Get("/users/{id}", h)
+	o.Post("/users/{id}", h)
+	o.Get("/users/{id}/posts/{post}", h)
+	o.Get("/static/*", h)
+	o.NotFound(h)
+	o.MethodNotAllowed(h)
+	return o
+}
+
+var serveCases = []struct{ name, method, path string }{
+	{"Static", "GET", "/users"},
+	{"Param", "GET", "/users/42"},
+	{"Params", "GET", "/users/42/posts/7"},
+	{"CatchAll", "GET", "/static/css/site.css"},
+	{"NotFound", "GET", "/missing"},
+	{"MethodNotAllowed", "DELETE", "/users/42"},
+}
+
+// The request keeps a context of its own: once it is served, neither its
+// cancellation nor its values are taken from a later request.
+func TestRequestContextNotReused(t *testing.T) {
+	type key struct{}
+	var saved context.Context
+	o := NewOrbit()
+	o.Get("/users/{id}", func(b Bits) error {
+		if saved == nil {
+			saved = b.Request().Context()
+		}
+		return nil
+	})
+
+	ctx1, cancel1 := context.WithCancel(context.WithValue(context.Background(), key{}, "req1"))
+	r1 := httptest.NewRequest("GET", "/users/1", nil).WithContext(ctx1)
+	o.ServeHTTP(httptest.NewRecorder(), r1)
+	cancel1()
+
+	r2 := httptest.NewRequest("GET", "/users/2", nil)
+	r2 = r2.WithContext(context.WithValue(r2.Context(), key{}, "req2"))
+	o.ServeHTTP(httptest.NewRecorder(), r2)
+
+	if saved.Err() != context.Canceled {
+		t.Errorf("Err() = %v, want %v", saved.Err(), context.Canceled)
+	}
+	if v := saved.Value(key{}); v != "req1" {
+		t.Errorf("Value() = %v, want req1", v)
+	}
+	if rctx := RouteContext(saved); rctx != nil {
+		t.Errorf("RouteContext() = %v, want nil once the request is served", rctx)
+	}
+	if id := URLParamFromCtx(saved, "id"); id != "" {
+		t.Errorf("URLParam(id) = %q, want empty", id)
+	}
+}
+
+// Serving a request allocates the request context and the request copy
+// holding it, nothing else. The request context isn't pooled on purpose:
+// a context kept past the handler must never see a later request.
+func TestServeHTTPAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't stable under the race detector")
+	}
+	o := newBenchOrbit()
+	w := &discardWriter{header: http.Header{}}
+	for _, bc := range serveCases {
+		r := httptest.NewRequest(bc.method, bc.path, nil)
+		if n := testing.AllocsPerRun(100, func() { o.ServeHTTP(w, r) }); n != 2 {
+			t.Errorf("%s %s: %v allocs, want 2", bc.method, bc.path, n)
+		}
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	o := newBenchOrbit()
+	w := &discardWriter{header: http.Header{}}
+	for _, bc := range serveCases {
+		r := httptest.NewRequest(bc.method, bc.path, nil)
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				o.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// HEAD runs the GET route with its inline middlewares, OPTIONS only runs
+// the router middlewares.
+func TestAutoMethodsMiddlewares(t *testing.T) {
+	mark := func(name string) func(Handler) Handler {
+		return func(next Handler) Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	o := NewOrbit()
+	o.AutoHead(true)
+	o.AutoOptions(true)
+	o.Use(mark("router"))
+	o.With(mark("route")).Get("/items", func(b Bits) error {
+		return b.Text(http.StatusOK, "items")
+	})
+
+	for _, tt := range []struct {
+		method string
+		code   int
+		want   []string
+	}{
+		{"HEAD", http.StatusOK, []string{"router", "route"}},
+		{"OPTIONS", http.StatusNoContent, []string{"router"}},
+	} {
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest(tt.method, "/items", nil))
+		if w.Code != tt.code {
+			t.Errorf("%s = %d, want %d", tt.method, w.Code, tt.code)
+		}
+		if got := w.Header().Values("X-Middleware"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s middlewares = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, httptest.NewRequest("HEAD", "/items", nil))
+	if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "5" {
+		t.Errorf("HEAD body = %q, Content-Length = %q", w.Body, w.Header().Get("Content-Length"))
+	}
+}
+
+// A Group can't scope a 404 handler, which would replace the one of the
+// router, while a sub-router from Route can.
+func TestNotFoundScope(t *testing.T) {
+	o := NewOrbit()
+	o.NotFound(func(b Bits) error { return b.Text(http.StatusNotFound, "router") })
+	o.Route("/api", func(r Router) {
+		r.NotFound(func(b Bits) error { return b.Text(http.StatusNotFound, "api") })
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("NotFound() in a Group didn't panic")
+			}
+		}()
+		o.Group(func(r Router) {
+			r.NotFound(func(b Bits) error { return nil })
+		})
+	}()
+
+	for path, want := range map[string]string{"/missing": "router", "/api/missing": "api"} {
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound || w.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want 404 %q", path, w.Code, w.Body, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package orbit
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlash is the policy for request paths that only differ from a
+// route by a trailing slash.
+type TrailingSlash int
+
+const (
+	// TrailingSlashStrict treats "/users" and "/users/" as different
+	// paths, the default.
+	TrailingSlashStrict TrailingSlash = iota
+
+	// TrailingSlashRedirect redirects to the route with, or without,
+	// the trailing slash.
+	TrailingSlashRedirect
+
+	// TrailingSlashServe serves the route with, or without, the
+	// trailing slash as is.
+	TrailingSlashServe
+)
+
+// PathPolicy sets how leniently a router matches request paths.
+type PathPolicy struct {
+	TrailingSlash TrailingSlash
+
+	// CleanPath redirects paths with dot segments or duplicate slashes,
+	// e.g. "/users//42/../7", to their cleaned version.
+	CleanPath bool
+
+	// CaseInsensitive matches static path segments regardless of case,
+	// e.g. "/Users/42" matches "/users/{id}". Params keep their case.
+	CaseInsensitive bool
+
+	// RedirectCode is the status of redirects, 301 or 308. Defaults to a
+	// 301 for GET and HEAD requests, and a 308 otherwise so that clients
+	// keep the method and body.
+	RedirectCode int
+}
+
+// PathPolicy sets the path matching policy of the router and of the
+// sub-routers mounted on it. Sub-routers mounted later inherit it unless
+// they set their own.
+func (o *Orbit) PathPolicy(p PathPolicy) {
+	m := o.owner()
+	m.pathPolicy = &p
+	m.updateSubRoutes(func(subMux *Orbit) {
+		subMux.PathPolicy(p)
+	})
+}
+
+// cleanRoutePath redirects to the cleaned `routePath` if it isn't clean
+// and the policy asks for it. It reports whether it did.
+func (o *Orbit) cleanRoutePath(w http.ResponseWriter, r *http.Request, routePath string) bool {
+	clean, ok := o.cleanTarget(routePath)
+	if !ok {
+		return false
+	}
+	o.redirectRoutePath(w, r, routePath, clean)
+	return true
+}
+
+// cleanTarget returns the cleaned `routePath`, and whether the policy
+// redirects to it.
+func (o *Orbit) cleanTarget(routePath string) (string, bool) {
+	if o.pathPolicy == nil || !o.pathPolicy.CleanPath {
+		return "", false
+	}
+	clean := path.Clean(routePath)
+	if strings.HasSuffix(routePath, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean, clean != routePath
+}
+
+// trailingSlash serves the route with the trailing slash of `routePath`
+// toggled, or redirects to it, if it exists and the policy asks for it.
+// It reports whether it did.
+func (o *Orbit) trailingSlash(w http.ResponseWriter, r *http.Request, rctx *Context, method methodTyp, routePath string) bool {
+	alt, _, h := o.trailingSlashRoute(rctx, method, routePath)
+	if h == nil {
+		return false
+	}
+	if o.pathPolicy.TrailingSlash == TrailingSlashRedirect {
+		o.redirectRoutePath(w, r, routePath, alt)
+		return true
+	}
+	h.ServeHTTP(w, r)
+	return true
+}
+
+// trailingSlashRoute finds the route of `routePath` with its trailing
+// slash toggled, if the policy doesn't treat them as different paths.
+func (o *Orbit) trailingSlashRoute(rctx *Context, method methodTyp, routePath string) (string, *node, Handler) {
+	if o.pathPolicy == nil || o.pathPolicy.TrailingSlash == TrailingSlashStrict || routePath == "/" {
+		return "", nil, nil
+	}
+
+	alt := routePath + "/"
+	if strings.HasSuffix(routePath, "/") {
+		alt = strings.TrimSuffix(routePath, "/")
+	}
+	n, _, h := o.root().FindRoute(rctx, method, alt)
+	if h == nil {
+		// The original path wasn't found at all, not a 405.
+		rctx.methodNotAllowed = false
+		rctx.methodsAllowed = rctx.methodsAllowed[:0]
+		return "", nil, nil
+	}
+	return alt, n, h
+}
+
+// redirectRoutePath redirects the request to its URL with `routePath`, the
+// part of the path routed by this router, replaced by `target`.
+func (o *Orbit) redirectRoutePath(w http.ResponseWriter, r *http.Request, routePath, target string) {
+	code := o.pathPolicy.RedirectCode
+	if code == 0 {
+		code = http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+	}
+	http.Redirect(w, r, redirectLocation(r, routePath, target), code)
+}
+
+// redirectLocation returns the URL of the request with `routePath`, the
+// part of the path routed by the current router, replaced by `target`. The
+// query string is kept.
+func redirectLocation(r *http.Request, routePath, target string) string {
+	raw := r.URL.RawPath != ""
+	full := r.URL.Path
+	if raw {
+		full = r.URL.RawPath
+	}
+
+	// Keep the part of the path routed by the routers this one is mounted
+	// on, which already went through their own policies.
+	prefix := strings.TrimSuffix(strings.TrimSuffix(full, routePath[1:]), "/")
+
+	// Never let a path starting with "//" turn into a protocol relative
+	// URL pointing at another host.
+	location := "/" + strings.TrimLeft(prefix+target, "/")
+
+	u := url.URL{Path: location, RawQuery: r.URL.RawQuery}
+	if raw {
+		u.RawPath = u.Path
+		u.Path, _ = url.PathUnescape(u.RawPath)
+	}
+	return u.String()
+}
+
+// findFoldEdge returns the static node whose prefix matches the start of
+// `search` regardless of case.
+func (ns nodes) findFoldEdge(search string) *node {
+	for _, n := range ns {
+		if len(search) >= len(n.prefix) && strings.EqualFold(search[:len(n.prefix)], n.prefix) {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package orbit
+
+// raceEnabled skips the allocation tests, sync.Pool drops items at random
+// under the race detector.
+const raceEnabled = true
@@ -17,6 +17,10 @@ type Router interface {
 	// With adds inline middlewares for an endpoint handler.
 	With(middlewares ...func(Handler) Handler) Router
 
+	// When adds an inline-Router whose routes only match requests
+	// passing all the `matchers`.
+	When(matchers ...Matcher) Router
+
 	// Group adds a new inline-Router along the current routing
 	// path, with a fresh middleware stack for the inline-Router.
 	Group(fn func(r Router)) Router
@@ -29,24 +33,29 @@ type Router interface {
 
 	// Handle and HandleFunc adds routes for `pattern` that matches
 	// all HTTP methods.
-	Handle(pattern string, h Handler)
-	HandleFunc(pattern string, h HandlerFunc)
+	Handle(pattern string, h Handler) *RouteHandle
+	HandleFunc(pattern string, h HandlerFunc) *RouteHandle
 
 	// Method and MethodFunc adds routes for `pattern` that matches
 	// the `method` HTTP method.
-	Method(method, pattern string, h Handler)
-	MethodFunc(method, pattern string, h HandlerFunc)
-
-	// HTTP-method routing along `pattern`
-	Connect(pattern string, h HandlerFunc)
-	Delete(pattern string, h HandlerFunc)
-	Get(pattern string, h HandlerFunc)
-	Head(pattern string, h HandlerFunc)
-	Options(pattern string, h HandlerFunc)
-	Patch(pattern string, h HandlerFunc)
-	Post(pattern string, h HandlerFunc)
-	Put(pattern string, h HandlerFunc)
-	Trace(pattern string, h HandlerFunc)
+	Method(method, pattern string, h Handler) *RouteHandle
+	MethodFunc(method, pattern string, h HandlerFunc) *RouteHandle
+
+	// HTTP-method routing along `pattern`. The returned RouteHandle
+	// names the route for reverse routing.
+	Connect(pattern string, h HandlerFunc) *RouteHandle
+	Delete(pattern string, h HandlerFunc) *RouteHandle
+	Get(pattern string, h HandlerFunc) *RouteHandle
+	Head(pattern string, h HandlerFunc) *RouteHandle
+	Options(pattern string, h HandlerFunc) *RouteHandle
+	Patch(pattern string, h HandlerFunc) *RouteHandle
+	Post(pattern string, h HandlerFunc) *RouteHandle
+	Put(pattern string, h HandlerFunc) *RouteHandle
+	Trace(pattern string, h HandlerFunc) *RouteHandle
+
+	// WebSocket adds a GET route upgrading requests to WebSocket
+	// connections served by `fn`.
+	WebSocket(pattern string, fn WebSocketFunc, opts ...WebSocketOption) *RouteHandle
 
 	// NotFound defines a handler to respond whenever a route could
 	// not be found.
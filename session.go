@@ -0,0 +1,450 @@
+package orbit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// SessionCtxKey is the context.Context key to store the request session.
+	SessionCtxKey = &contextKey{"Session"}
+)
+
+// SessionStore persists server side session data. The data is opaque to the
+// store, it only has to hand back what it was given until `expiry` passes.
+// Load reports found=false for unknown or expired ids.
+type SessionStore interface {
+	Load(ctx context.Context, id string) (data []byte, found bool, err error)
+	Save(ctx context.Context, id string, data []byte, expiry time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionOptions configures the Session middleware.
+type SessionOptions struct {
+	// Store keeps session data on the server, with only the session id
+	// sent to the client. When nil, the whole session is kept in the
+	// cookie itself and Codec is required.
+	Store SessionStore
+
+	// Codec signs, and optionally encrypts, the session cookie. It is
+	// optional with a Store, since session ids are already unguessable.
+	Codec *SecureCookie
+
+	// CookieName defaults to "orbit_session".
+	CookieName string
+
+	// Cookie adjusts the session cookie attributes on top of the
+	// defaults used by Bits.SetCookie.
+	Cookie []CookieOption
+
+	// IdleTimeout ends a session that hasn't been used for this long.
+	// Defaults to 30 minutes.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout ends a session this long after it was created,
+	// regardless of activity. Defaults to 24 hours.
+	AbsoluteTimeout time.Duration
+}
+
+// Session returns a middleware that loads the session for every request and
+// makes it available through Bits.Session() and SessionContext. Changes are
+// saved right before the response header is written. They aren't saved for
+// a hijacked connection, e.g. a WebSocket, which sends no response to carry
+// the session cookie.
+//
+// Values are serialized with encoding/gob, so custom types stored in a
+// session must be registered with gob.Register.
+func Session(opts SessionOptions) func(Handler) Handler {
+	m := newSessionManager(opts)
+
+	return func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := m.load(r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			sw := &sessionWriter{ResponseWriter: w}
+			sw.commit = func() error { return m.commit(w, r, s) }
+
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), SessionCtxKey, s)))
+
+			if !sw.wroteHeader {
+				if err := sw.commit(); err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}
+		})
+	}
+}
+
+// SessionContext returns the session loaded by the Session middleware from
+// a http.Request Context, or nil if the middleware isn't in use.
+func SessionContext(ctx context.Context) *SessionState {
+	s, _ := ctx.Value(SessionCtxKey).(*SessionState)
+	return s
+}
+
+// SessionState is the session of a single request. It is safe for
+// concurrent use by the goroutines serving that request.
+type SessionState struct {
+	mu sync.Mutex
+
+	id  string
+	rec sessionRecord
+
+	// oldID is a previous id that must be removed from the store
+	// on commit, after Regenerate or Destroy.
+	oldID string
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	committed bool
+}
+
+type sessionRecord struct {
+	Values   map[string]interface{}
+	Flashes  map[string][]interface{}
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// ID returns the current session id.
+func (s *SessionState) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Get returns the value stored under `key`, or nil.
+func (s *SessionState) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec.Values[key]
+}
+
+// Set stores `value` under `key`.
+func (s *SessionState) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch()
+	s.rec.Values[key] = value
+}
+
+// Delete removes the value stored under `key`.
+func (s *SessionState) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rec.Values[key]; ok {
+		s.touch()
+		delete(s.rec.Values, key)
+	}
+}
+
+// Flash queues `value` under `key` until it is read with Flashes, usually
+// on the next request.
+func (s *SessionState) Flash(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch()
+	s.rec.Flashes[key] = append(s.rec.Flashes[key], value)
+}
+
+// Flashes returns and clears the values queued under `key` with Flash.
+func (s *SessionState) Flashes(key string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vs, ok := s.rec.Flashes[key]
+	if ok {
+		s.touch()
+		delete(s.rec.Flashes, key)
+	}
+	return vs
+}
+
+// Regenerate moves the session to a fresh id and restarts its absolute
+// timeout, keeping its values. Call it whenever the privilege level of the
+// session changes, such as on login, to prevent session fixation.
+func (s *SessionState) Regenerate() error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = id
+	s.rec.Created = time.Now()
+	s.modified = true
+	return nil
+}
+
+// Destroy removes all session data and expires the session cookie. Values
+// set afterwards start a brand new session.
+func (s *SessionState) Destroy() error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = id
+	s.rec = newSessionRecord()
+	s.isNew = true
+	s.modified = false
+	s.destroyed = true
+	return nil
+}
+
+// touch marks the session as modified. It must be called with mu held.
+func (s *SessionState) touch() {
+	s.modified = true
+	s.destroyed = false
+}
+
+func newSessionRecord() sessionRecord {
+	return sessionRecord{
+		Values:  map[string]interface{}{},
+		Flashes: map[string][]interface{}{},
+		Created: time.Now(),
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type sessionManager struct {
+	store    SessionStore
+	codec    *SecureCookie
+	name     string
+	cookie   []CookieOption
+	idle     time.Duration
+	absolute time.Duration
+}
+
+func newSessionManager(opts SessionOptions) *sessionManager {
+	if opts.Store == nil && opts.Codec == nil {
+		panic("orbit: cookie-backed sessions require a SessionOptions.Codec")
+	}
+
+	m := &sessionManager{
+		store:    opts.Store,
+		codec:    opts.Codec,
+		name:     opts.CookieName,
+		cookie:   opts.Cookie,
+		idle:     opts.IdleTimeout,
+		absolute: opts.AbsoluteTimeout,
+	}
+	if m.name == "" {
+		m.name = "orbit_session"
+	}
+	if m.idle <= 0 {
+		m.idle = 30 * time.Minute
+	}
+	if m.absolute <= 0 {
+		m.absolute = 24 * time.Hour
+	}
+	return m
+}
+
+// load returns the session referenced by the request cookie, or a new
+// empty session if there is none or it has timed out.
+func (m *sessionManager) load(r *http.Request) (*SessionState, error) {
+	if c, err := r.Cookie(m.name); err == nil && c.Value != "" {
+		id, data, found, err := m.read(r.Context(), c.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var rec sessionRecord
+		if found && gob.NewDecoder(bytes.NewReader(data)).Decode(&rec) == nil {
+			now := time.Now()
+			if now.Sub(rec.LastSeen) <= m.idle && now.Sub(rec.Created) <= m.absolute {
+				if rec.Values == nil {
+					rec.Values = map[string]interface{}{}
+				}
+				if rec.Flashes == nil {
+					rec.Flashes = map[string][]interface{}{}
+				}
+				return &SessionState{id: id, rec: rec}, nil
+			}
+			if m.store != nil {
+				if err := m.store.Delete(r.Context(), id); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return &SessionState{id: id, rec: newSessionRecord(), isNew: true}, nil
+}
+
+// read resolves a cookie value to a session id and its encoded record.
+func (m *sessionManager) read(ctx context.Context, value string) (string, []byte, bool, error) {
+	if m.store == nil {
+		data, err := m.codec.Decode(m.name, value)
+		if err != nil {
+			return "", nil, false, nil
+		}
+		id, err := newSessionID()
+		return id, []byte(data), true, err
+	}
+
+	id := value
+	if m.codec != nil {
+		var err error
+		if id, err = m.codec.Decode(m.name, value); err != nil {
+			return "", nil, false, nil
+		}
+	}
+	data, found, err := m.store.Load(ctx, id)
+	return id, data, found, err
+}
+
+// commit persists the session and writes the session cookie. It runs at most
+// once per request.
+func (m *sessionManager) commit(w http.ResponseWriter, r *http.Request, s *SessionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.committed {
+		return nil
+	}
+	s.committed = true
+
+	if s.oldID != "" && m.store != nil {
+		if err := m.store.Delete(r.Context(), s.oldID); err != nil {
+			return err
+		}
+	}
+
+	if s.destroyed {
+		c := newCookie(m.name, "", m.cookie)
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+		http.SetCookie(w, c)
+		return nil
+	}
+
+	// Don't hand out cookies to clients that never stored anything.
+	if s.isNew && !s.modified {
+		return nil
+	}
+
+	now := time.Now()
+	s.rec.LastSeen = now
+	expiry := now.Add(m.idle)
+	if deadline := s.rec.Created.Add(m.absolute); deadline.Before(expiry) {
+		expiry = deadline
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s.rec); err != nil {
+		return err
+	}
+
+	var value string
+	var err error
+	if m.store == nil {
+		value, err = m.codec.Encode(m.name, buf.String())
+	} else {
+		if err = m.store.Save(r.Context(), s.id, buf.Bytes(), expiry); err != nil {
+			return err
+		}
+		value = s.id
+		if m.codec != nil {
+			value, err = m.codec.Encode(m.name, s.id)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := append([]CookieOption{CookieMaxAge(time.Until(expiry))}, m.cookie...)
+	http.SetCookie(w, newCookie(m.name, value, opts))
+	return nil
+}
+
+// sessionWriter commits the session right before the response header is
+// written, while it can still set the session cookie.
+type sessionWriter struct {
+	http.ResponseWriter
+	commit      func() error
+	wroteHeader bool
+	failed      bool
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	if err := sw.commit(); err != nil {
+		// Don't send a response that assumes the session was saved.
+		sw.failed = true
+		http.Error(sw.ResponseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(p []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.failed {
+		return len(p), nil
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *sessionWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok && !sw.failed {
+		f.Flush()
+	}
+}
+
+func (sw *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("orbit: response writer does not support hijacking")
+	}
+	// The session cookie could only go out with a response, which a
+	// hijacked connection never gets: the session is left as loaded.
+	sw.wroteHeader = true
+	return hj.Hijack()
+}
+
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,192 @@
+package orbit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	_ SessionStore = &MemoryStore{}
+	_ SessionStore = &FileStore{}
+)
+
+// MemoryStore is a SessionStore that keeps sessions in process memory.
+// Expired sessions are swept lazily, so it needs no background goroutine.
+type MemoryStore struct {
+	mu        sync.Mutex
+	items     map[string]memoryItem
+	lastSweep time.Time
+}
+
+type memoryItem struct {
+	data   []byte
+	expiry time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]memoryItem{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Load(_ context.Context, id string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[id]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(it.expiry) {
+		delete(s.items, id)
+		return nil, false, nil
+	}
+	return it.data, true, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, id string, data []byte, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, it := range s.items {
+			if now.After(it.expiry) {
+				delete(s.items, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.items[id] = memoryItem{data: append([]byte(nil), data...), expiry: expiry}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// FileStore is a SessionStore that keeps one file per session in a
+// directory. Each file holds the expiry followed by the session data.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore rooted at `dir`, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("orbit: session store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Load(_ context.Context, id string) ([]byte, bool, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(b) < 8 {
+		return nil, false, nil
+	}
+	if time.Now().After(time.Unix(int64(binary.BigEndian.Uint64(b[:8])), 0)) {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	return b[8:], true, nil
+}
+
+func (s *FileStore) Save(_ context.Context, id string, data []byte, expiry time.Time) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(b, uint64(expiry.Unix()))
+	b = append(b, data...)
+
+	// Write to a temporary file first so readers never see a partial session.
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Sweep removes every expired session file. FileStore only drops expired
+// sessions when they are loaded, so call it periodically to reclaim space.
+func (s *FileStore) Sweep() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var hdr [8]byte
+		_, err = f.Read(hdr[:])
+		f.Close()
+		if err != nil || now.After(time.Unix(int64(binary.BigEndian.Uint64(hdr[:])), 0)) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// path maps a session id to its file, rejecting ids that could escape the
+// store directory. Ids are base64url, so anything else is invalid.
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || len(id) > 128 {
+		return "", errors.New("orbit: invalid session id")
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return "", errors.New("orbit: invalid session id")
+		}
+	}
+	return filepath.Join(s.dir, id), nil
+}
@@ -0,0 +1,167 @@
+package orbit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingStore is a MemoryStore counting the saves.
+type countingStore struct {
+	*MemoryStore
+	saves int
+}
+
+func (s *countingStore) Save(ctx context.Context, id string, data []byte, expiry time.Time) error {
+	s.saves++
+	return s.MemoryStore.Save(ctx, id, data, expiry)
+}
+
+func newSessionOrbit(opts SessionOptions) *Orbit {
+	o := NewOrbit()
+	o.Use(Session(opts))
+	o.Post("/login", func(b Bits) error {
+		if err := b.Session().Regenerate(); err != nil {
+			return err
+		}
+		b.Session().Set("user", "alice")
+		return b.Text(http.StatusOK, b.Session().ID())
+	})
+	o.Get("/visit", func(b Bits) error {
+		b.Session().Set("visited", true)
+		return b.Text(http.StatusOK, b.Session().ID())
+	})
+	o.Get("/whoami", func(b Bits) error {
+		user, _ := b.Session().Get("user").(string)
+		return b.Text(http.StatusOK, user)
+	})
+	return o
+}
+
+// sessionRequest serves `method` `path` with the session cookie `c`, and
+// returns the response and the session cookie it set, if any.
+func sessionRequest(o *Orbit, method, path string, c *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	r := httptest.NewRequest(method, path, nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, r)
+	for _, sc := range w.Result().Cookies() {
+		if sc.Name == "orbit_session" {
+			return w, sc
+		}
+	}
+	return w, nil
+}
+
+// Logging in moves the session to a fresh id, so an id planted before
+// login is worthless afterwards.
+func TestSessionFixation(t *testing.T) {
+	o := newSessionOrbit(SessionOptions{Store: NewMemoryStore()})
+
+	_, planted := sessionRequest(o, "GET", "/visit", nil)
+	if planted == nil {
+		t.Fatal("no session cookie")
+	}
+	w, login := sessionRequest(o, "POST", "/login", planted)
+	if login == nil || login.Value == planted.Value || w.Body.String() != login.Value {
+		t.Fatalf("login cookie = %v, want a new id", login)
+	}
+
+	if w, _ := sessionRequest(o, "GET", "/whoami", login); w.Body.String() != "alice" {
+		t.Errorf("whoami with the new id = %q, want alice", w.Body)
+	}
+	if w, _ := sessionRequest(o, "GET", "/whoami", planted); w.Body.String() != "" {
+		t.Errorf("whoami with the planted id = %q, want an empty session", w.Body)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	codec := mustSecureCookie(t, CookieKey{Hash: cookieHashKey})
+	for _, tt := range []struct {
+		name string
+		opts SessionOptions
+	}{
+		{"Idle", SessionOptions{Store: NewMemoryStore(), IdleTimeout: 20 * time.Millisecond}},
+		{"Absolute", SessionOptions{Store: NewMemoryStore(), AbsoluteTimeout: 20 * time.Millisecond}},
+		{"CookieIdle", SessionOptions{Codec: codec, IdleTimeout: 20 * time.Millisecond}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newSessionOrbit(tt.opts)
+			_, c := sessionRequest(o, "POST", "/login", nil)
+			if w, _ := sessionRequest(o, "GET", "/whoami", c); w.Body.String() != "alice" {
+				t.Fatalf("whoami = %q, want alice", w.Body)
+			}
+			time.Sleep(40 * time.Millisecond)
+			if w, _ := sessionRequest(o, "GET", "/whoami", c); w.Body.String() != "" {
+				t.Errorf("whoami after the timeout = %q, want an empty session", w.Body)
+			}
+		})
+	}
+}
+
+// The cookie is set right before the header is written, however it is
+// written.
+func TestSessionCommit(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		write func(w http.ResponseWriter)
+	}{
+		{"WriteHeader", func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) }},
+		{"Write", func(w http.ResponseWriter) { w.Write([]byte("ok")) }},
+		{"Flush", func(w http.ResponseWriter) { w.(http.Flusher).Flush() }},
+		{"Nothing", func(w http.ResponseWriter) {}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOrbit()
+			o.Use(Session(SessionOptions{Store: NewMemoryStore()}))
+			o.Get("/", func(b Bits) error {
+				b.Session().Set("k", "v")
+				tt.write(b.Response())
+				// Too late, the header is out.
+				b.Session().Set("late", "v")
+				return nil
+			})
+
+			w := httptest.NewRecorder()
+			o.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if len(w.Result().Cookies()) != 1 {
+				t.Errorf("cookies = %v, want the session cookie", w.Result().Cookies())
+			}
+		})
+	}
+
+	// Sessions nobody wrote to don't get a cookie.
+	o := newSessionOrbit(SessionOptions{Store: NewMemoryStore()})
+	if _, c := sessionRequest(o, "GET", "/whoami", nil); c != nil {
+		t.Errorf("untouched session got cookie %v", c)
+	}
+}
+
+// A hijacked connection sends no response, so the session isn't saved for
+// a cookie that would never reach the client.
+func TestSessionHijack(t *testing.T) {
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	o := NewOrbit()
+	o.Use(Session(SessionOptions{Store: store}))
+	o.Get("/ws", func(b Bits) error {
+		b.Session().Set("k", "v")
+		conn, _, err := http.NewResponseController(b.Response()).Hijack()
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	o.ServeHTTP(hr, httptest.NewRequest("GET", "/ws", nil))
+	if !hr.hijacked {
+		t.Fatal("the connection wasn't hijacked")
+	}
+	if store.saves != 0 || hr.Header().Get("Set-Cookie") != "" {
+		t.Errorf("hijacked request saved the session: %d saves, Set-Cookie %q", store.saves, hr.Header().Get("Set-Cookie"))
+	}
+}
@@ -0,0 +1,100 @@
+package orbit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// servers holds the registry of each server serving WebSocket connections
+// or event streams. A server's registry is kept once it shut down, so that
+// requests still being served see it closed rather than getting a new one.
+var servers sync.Map // *http.Server -> *serverRegistry
+
+// serverRegistry tracks what the server can't: hijacked WebSocket
+// connections, closed with CloseGoingAway when it shuts down, and the
+// event streams ended by `closing`.
+type serverRegistry struct {
+	srv     *http.Server
+	mu      sync.Mutex
+	conns   map[*Conn]struct{}
+	closed  bool
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// registry returns the registry of `srv`, created on first use.
+func registry(srv *http.Server) *serverRegistry {
+	if v, ok := servers.Load(srv); ok {
+		return v.(*serverRegistry)
+	}
+	reg := &serverRegistry{srv: srv, conns: map[*Conn]struct{}{}, closing: make(chan struct{})}
+	v, loaded := servers.LoadOrStore(srv, reg)
+	if !loaded {
+		srv.RegisterOnShutdown(reg.shutdown)
+	}
+	return v.(*serverRegistry)
+}
+
+// serving returns the registry of the server serving `r`, nil if unknown.
+func serving(r *http.Request) *serverRegistry {
+	srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+	if !ok {
+		return nil
+	}
+	return registry(srv)
+}
+
+// track registers `c`, or closes it if the server is shutting down.
+func (reg *serverRegistry) track(c *Conn) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.closed {
+		c.Close(CloseGoingAway, "server shutting down")
+		return
+	}
+	reg.conns[c] = struct{}{}
+	reg.wg.Add(1)
+
+	go func() {
+		<-c.finished
+		reg.mu.Lock()
+		delete(reg.conns, c)
+		reg.mu.Unlock()
+		reg.wg.Done()
+	}()
+}
+
+func (reg *serverRegistry) shutdown() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.closed {
+		return
+	}
+	reg.closed = true
+	close(reg.closing)
+	for c := range reg.conns {
+		c.Close(CloseGoingAway, "server shutting down")
+	}
+}
+
+// wait waits for the connections to finish their closing handshake, or for
+// `ctx` to be done.
+func (reg *serverRegistry) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		reg.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forget drops the registry once the server is done serving.
+func (reg *serverRegistry) forget() {
+	servers.CompareAndDelete(reg.srv, reg)
+}
@@ -0,0 +1,168 @@
+package orbit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SPAOptions configures SPA.
+type SPAOptions struct {
+	// APIPrefixes are the path prefixes that are never answered with the
+	// index, so unknown API routes get a 404 from the NotFound handler.
+	// They are relative to the mount point, like the paths of the files.
+	// Defaults to "/api/".
+	APIPrefixes []string
+
+	// Config returns the runtime config of the frontend, e.g. the URL of
+	// the API, available to the index template as {{.Config}}:
+	//
+	//	<script>window.config = {{.Config}}</script>
+	//
+	// html/template encodes it as JSON inside a script. Without Config,
+	// the index is served as is.
+	Config func(r *http.Request) any
+
+	// Static configures the serving of the files of the app. The index
+	// is always served with "Cache-Control: no-cache", so new releases
+	// are picked up.
+	Static StaticOptions
+}
+
+// SPAData is the data of the index template of SPA.
+type SPAData struct {
+	Request *http.Request
+	Config  any
+}
+
+// SPA returns a handler serving a single page application from `fsys`,
+// to mount at the root of a router, e.g.
+//
+//	o.Mount("/", orbit.SPA(dist, "index.html", orbit.SPAOptions{}))
+//
+// Files that exist are served like FileServer does. Other GET and HEAD
+// requests for pages of the app get the `index` file, so the app routes
+// them on the client. Requests are considered for pages of the app unless
+// they are under an API prefix, their last segment has a file extension,
+// like a missing asset, or their Accept header asks for neither
+// "text/html" nor "*/*". Everything else gets the NotFound handler of the
+// router.
+//
+// SPA panics if Config is set and `index` can't be parsed as a template.
+func SPA(fsys fs.FS, index string, opts SPAOptions) HandlerFunc {
+	if opts.APIPrefixes == nil {
+		opts.APIPrefixes = []string{"/api/"}
+	}
+	s := &spa{
+		files: newFileServer(fsys, opts.Static),
+		index: newFileServer(fsys, StaticOptions{
+			Precompressed: opts.Static.Precompressed,
+			CacheControl:  "no-cache",
+			Fingerprinted: func(string) bool { return false },
+		}),
+		name: index,
+		opts: opts,
+	}
+	if opts.Config != nil {
+		tmpl, err := template.ParseFS(fsys, index)
+		if err != nil {
+			panic(fmt.Sprintf("orbit: SPA() index template: %v", err))
+		}
+		s.tmpl = tmpl
+	}
+	return s.serve
+}
+
+type spa struct {
+	files *fileServer
+	index *fileServer
+	name  string
+	tmpl  *template.Template
+	opts  SPAOptions
+}
+
+func (s *spa) serve(b Bits) error {
+	r := b.Request()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return s.notFound(b)
+	}
+
+	// Paths are relative to the mount point.
+	raw := requestPath(r)
+	if rctx := RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		raw = rctx.RoutePath
+	}
+	if raw == "/" {
+		return s.serveIndex(b)
+	}
+
+	err := s.files.serveName(b, raw)
+	var he *HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusNotFound {
+		return err
+	}
+
+	if !s.isPage(r, raw) {
+		return s.notFound(b)
+	}
+	return s.serveIndex(b)
+}
+
+// isPage reports whether the request for `name`, its path relative to the
+// mount point, looks like a page of the app rather than an API call or an
+// asset.
+func (s *spa) isPage(r *http.Request, name string) bool {
+	for _, prefix := range s.opts.APIPrefixes {
+		if strings.HasPrefix(name, prefix) || name == strings.TrimSuffix(prefix, "/") {
+			return false
+		}
+	}
+	if path.Ext(path.Base(name)) != "" {
+		return false
+	}
+
+	accept := r.Header.Get("Accept")
+	return accept == "" || strings.Contains(accept, "text/html") || strings.Contains(accept, "*/*")
+}
+
+func (s *spa) serveIndex(b Bits) error {
+	w := b.Response()
+	w.Header().Add("Vary", "Accept")
+
+	if s.tmpl == nil {
+		info, err := fs.Stat(s.index.fsys, s.name)
+		if err != nil {
+			return err
+		}
+		return s.index.serveFile(w, b.Request(), s.name, info)
+	}
+
+	var buf bytes.Buffer
+	data := SPAData{Request: b.Request(), Config: s.opts.Config(b.Request())}
+	if err := s.tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if b.Request().Method == http.MethodHead {
+		return nil
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// notFound responds with the NotFound handler of the router serving the
+// request.
+func (s *spa) notFound(b Bits) error {
+	if rctx := RouteContext(b.Request().Context()); rctx != nil {
+		if o, ok := rctx.Routes.(interface{ NotFoundHandler() HandlerFunc }); ok {
+			return o.NotFoundHandler()(b)
+		}
+	}
+	return errNotFound()
+}
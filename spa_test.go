@@ -0,0 +1,38 @@
+package orbit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// The API prefixes and the extension check apply to the path under the
+// mount point.
+func TestSPAIsPage(t *testing.T) {
+	dist := fstest.MapFS{
+		"index.html":  {Data: []byte("<html>app</html>")},
+		"assets/a.js": {Data: []byte("js")},
+	}
+	o := NewOrbit()
+	o.Mount("/api/console", SPA(dist, "index.html", SPAOptions{}))
+
+	for _, tt := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/api/console/settings", http.StatusOK, "<html>app</html>"},
+		{"/api/console/assets/a.js", http.StatusOK, "js"},
+		{"/api/console/assets/missing.js", http.StatusNotFound, ""},
+		{"/api/console/api/users", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept", "text/html")
+		o.ServeHTTP(w, r)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body, tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package orbit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamClosed is returned by the methods of an SSEStream once the
+// client is gone, the server shuts down or the handler returned.
+var ErrStreamClosed = errors.New("orbit: event stream closed")
+
+// SSEOption configures an event stream opened by Bits.SSE.
+type SSEOption func(c *sseConfig)
+
+type sseConfig struct {
+	heartbeat time.Duration
+	retry     time.Duration
+	onError   func(r *http.Request, err error)
+}
+
+// SSEHeartbeat sets the interval of the comments sent to keep idle
+// connections from being closed by proxies. The default is 15 seconds, 0
+// disables them.
+func SSEHeartbeat(d time.Duration) SSEOption {
+	return func(c *sseConfig) { c.heartbeat = d }
+}
+
+// SSERetry tells the client how long to wait before reconnecting once the
+// connection is lost.
+func SSERetry(d time.Duration) SSEOption {
+	return func(c *sseConfig) { c.retry = d }
+}
+
+// SSEOnError sets the function getting the error returned by the handler
+// once the stream is open, which can't be sent to the client anymore. By
+// default it is logged to the ErrorLog of the server, or the standard
+// logger. ErrStreamClosed isn't reported, it only means the client is gone.
+func SSEOnError(fn func(r *http.Request, err error)) SSEOption {
+	return func(c *sseConfig) { c.onError = fn }
+}
+
+// logStreamError logs an error returned by the handler of an event
+// stream, like the server logs its own errors.
+func logStreamError(r *http.Request, err error) {
+	logf := log.Printf
+	if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.ErrorLog != nil {
+		logf = srv.ErrorLog.Printf
+	}
+	logf("orbit: event stream %s %s: %v", r.Method, r.URL.Path, err)
+}
+
+// SSEStream is a stream of server-sent events. It can be used from several
+// goroutines, but only until the handler that opened it returns.
+type SSEStream struct {
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	ctx         context.Context
+	cancel      context.CancelFunc
+	lastEventID string
+	onError     func(r *http.Request, err error)
+
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// SSE opens a stream of server-sent events on the response. It fails if
+// the response can't be flushed, e.g. through a buffering middleware.
+// Later calls return the open stream, and fail if they pass options, which
+// can't apply to it anymore.
+func (b *bits) SSE(opts ...SSEOption) (*SSEStream, error) {
+	if b.sse != nil {
+		if len(opts) > 0 {
+			return nil, errors.New("orbit: event stream already open, its options can't be changed")
+		}
+		return b.sse, nil
+	}
+
+	cfg := sseConfig{heartbeat: 15 * time.Second, onError: logStreamError}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	w := b.response
+	hdr := w.Header()
+	hdr.Set("Content-Type", "text/event-stream")
+	hdr.Set("Cache-Control", "no-cache")
+	hdr.Set("X-Accel-Buffering", "no")
+	hdr.Del("Content-Length")
+
+	ctx, cancel := context.WithCancel(b.request.Context())
+	s := &SSEStream{
+		w:           w,
+		rc:          http.NewResponseController(w),
+		ctx:         ctx,
+		cancel:      cancel,
+		lastEventID: b.request.Header.Get("Last-Event-ID"),
+		onError:     cfg.onError,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	// The stream outlives the write timeout of the server.
+	_ = s.rc.SetWriteDeadline(time.Time{})
+
+	w.WriteHeader(http.StatusOK)
+	if err := s.rc.Flush(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("orbit: event stream needs a flushable response: %w", err)
+	}
+	if cfg.retry > 0 {
+		if err := s.Retry(cfg.retry); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	// The server doesn't cancel requests when it shuts down, and would
+	// wait on the stream until its deadline.
+	if reg := serving(b.request); reg != nil {
+		go func() {
+			select {
+			case <-reg.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	b.sse = s
+	if cfg.heartbeat > 0 {
+		go s.heartbeat(cfg.heartbeat)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting
+// client, the ID of the last event it got.
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed once the client is gone or the server shuts down.
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send sends an event. `event` and `id` are optional. `data` is sent as is
+// if it is a string or a []byte, and encoded as JSON otherwise; multiline
+// data is split across data fields.
+func (s *SSEStream) Send(event, id string, data any) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n\x00") {
+		return errors.New("orbit: event and id must be single line")
+	}
+
+	var payload string
+	switch d := data.(type) {
+	case string:
+		payload = d
+	case []byte:
+		payload = string(d)
+	default:
+		buf, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		payload = string(buf)
+	}
+
+	var sb strings.Builder
+	if id != "" {
+		sb.WriteString("id: " + id + "\n")
+	}
+	if event != "" {
+		sb.WriteString("event: " + event + "\n")
+	}
+	for _, line := range splitLines(payload) {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+// Comment sends a comment, which clients ignore.
+func (s *SSEStream) Comment(text string) error {
+	var sb strings.Builder
+	for _, line := range splitLines(text) {
+		sb.WriteString(": " + line + "\n")
+	}
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+// Retry tells the client how long to wait before reconnecting once the
+// connection is lost.
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+func (s *SSEStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+	if _, err := io.WriteString(s.w, msg); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *SSEStream) heartbeat(d time.Duration) {
+	defer close(s.done)
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if s.write(":\n\n") != nil {
+				return
+			}
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// close ends the stream when the handler returns, as the response can't be
+// written anymore.
+func (s *SSEStream) close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+	s.cancel()
+}
+
+// handlerError reports the error returned by the handler of the stream.
+func (s *SSEStream) handlerError(r *http.Request, err error) {
+	if s.onError != nil && !errors.Is(err, ErrStreamClosed) {
+		s.onError(r, err)
+	}
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.ReplaceAll(s, "\r", "\n"), "\n")
+}
+
+// SSEEvent is an event published on an SSEBroker.
+type SSEEvent struct {
+	Event string
+	ID    string
+	Data  any
+}
+
+// DropPolicy is what an SSEBroker does with an event for a subscriber
+// whose buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest drops the event, the default.
+	DropNewest DropPolicy = iota
+
+	// DropOldest drops the oldest buffered event to make room for it.
+	DropOldest
+
+	// DropSubscriber disconnects the subscriber, which can catch up
+	// through Last-Event-ID when it reconnects.
+	DropSubscriber
+)
+
+// SSEBrokerOptions configures an SSEBroker.
+type SSEBrokerOptions struct {
+	// Buffer is the number of events buffered for each subscriber.
+	// Defaults to 16.
+	Buffer int
+
+	// Policy applies when the buffer of a subscriber is full.
+	Policy DropPolicy
+
+	// History is the number of the last events with an ID kept to be
+	// replayed to clients reconnecting with a Last-Event-ID.
+	History int
+}
+
+// SSEBroker fans events out to many subscribers, each with a buffer of its
+// own so that a slow client doesn't hold the others back, e.g.
+//
+//	broker := orbit.NewSSEBroker(orbit.SSEBrokerOptions{History: 100})
+//	o.Get("/events", func(b orbit.Bits) error {
+//		s, err := b.SSE()
+//		if err != nil {
+//			return err
+//		}
+//		return broker.Serve(s)
+//	})
+//	broker.Publish(orbit.SSEEvent{Event: "tick", ID: "42", Data: stats})
+type SSEBroker struct {
+	opts SSEBrokerOptions
+
+	mu      sync.Mutex
+	subs    map[*SSESubscriber]struct{}
+	history []SSEEvent
+}
+
+// SSESubscriber receives the events of an SSEBroker.
+type SSESubscriber struct {
+	broker  *SSEBroker
+	events  chan SSEEvent
+	dropped atomic.Uint64
+}
+
+// NewSSEBroker returns a broker without subscribers.
+func NewSSEBroker(opts SSEBrokerOptions) *SSEBroker {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 16
+	}
+	return &SSEBroker{opts: opts, subs: map[*SSESubscriber]struct{}{}}
+}
+
+// Publish sends `ev` to every subscriber, without blocking.
+func (br *SSEBroker) Publish(ev SSEEvent) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	if ev.ID != "" && br.opts.History > 0 {
+		if len(br.history) == br.opts.History {
+			copy(br.history, br.history[1:])
+			br.history = br.history[:len(br.history)-1]
+		}
+		br.history = append(br.history, ev)
+	}
+
+	for sub := range br.subs {
+		select {
+		case sub.events <- ev:
+			continue
+		default:
+		}
+
+		sub.dropped.Add(1)
+		switch br.opts.Policy {
+		case DropOldest:
+			select {
+			case <-sub.events:
+			default:
+			}
+			select {
+			case sub.events <- ev:
+			default:
+			}
+		case DropSubscriber:
+			br.remove(sub)
+		}
+	}
+}
+
+// Subscribe adds a subscriber. The events published after `lastEventID`
+// are replayed if it's still in the history.
+func (br *SSEBroker) Subscribe(lastEventID string) *SSESubscriber {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	var replay []SSEEvent
+	if lastEventID != "" {
+		for i, ev := range br.history {
+			if ev.ID == lastEventID {
+				replay = br.history[i+1:]
+				break
+			}
+		}
+	}
+
+	size := br.opts.Buffer
+	if len(replay) > size {
+		size = len(replay)
+	}
+	sub := &SSESubscriber{broker: br, events: make(chan SSEEvent, size)}
+	for _, ev := range replay {
+		sub.events <- ev
+	}
+	br.subs[sub] = struct{}{}
+	return sub
+}
+
+// Len returns the number of subscribers.
+func (br *SSEBroker) Len() int {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return len(br.subs)
+}
+
+// Serve subscribes the stream and sends it the events until the client is
+// gone or gets disconnected by the DropSubscriber policy.
+func (br *SSEBroker) Serve(s *SSEStream) error {
+	sub := br.Subscribe(s.LastEventID())
+	defer sub.Close()
+
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if err := s.Send(ev.Event, ev.ID, ev.Data); err != nil {
+				if errors.Is(err, ErrStreamClosed) {
+					return nil
+				}
+				return err
+			}
+		case <-s.Done():
+			return nil
+		}
+	}
+}
+
+func (br *SSEBroker) remove(sub *SSESubscriber) {
+	if _, ok := br.subs[sub]; ok {
+		delete(br.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Events returns the channel of the events. It is closed once the
+// subscriber is closed or disconnected.
+func (sub *SSESubscriber) Events() <-chan SSEEvent {
+	return sub.events
+}
+
+// Dropped returns the number of events the subscriber missed because its
+// buffer was full.
+func (sub *SSESubscriber) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Close unsubscribes the subscriber.
+func (sub *SSESubscriber) Close() {
+	sub.broker.mu.Lock()
+	defer sub.broker.mu.Unlock()
+	sub.broker.remove(sub)
+}
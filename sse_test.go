@@ -0,0 +1,164 @@
+package orbit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSSE serves `h` on GET /events and returns the response.
+func serveSSE(h HandlerFunc, header http.Header) *httptest.ResponseRecorder {
+	o := NewOrbit()
+	o.Get("/events", h)
+	r := httptest.NewRequest("GET", "/events", nil)
+	for k, vs := range header {
+		r.Header[k] = vs
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, r)
+	return w
+}
+
+func TestSSESend(t *testing.T) {
+	w := serveSSE(func(b Bits) error {
+		s, err := b.SSE(SSEHeartbeat(0), SSERetry(3*time.Second))
+		if err != nil {
+			return err
+		}
+		s.Send("greeting", "1", "hello\nworld")
+		s.Send("", "", map[string]int{"n": 2})
+		s.Comment("note")
+		if err := s.Send("bad\nevent", "", ""); err == nil {
+			t.Error("Send() accepted a multiline event")
+		}
+		return nil
+	}, nil)
+
+	want := "retry: 3000\n\n" +
+		"id: 1\nevent: greeting\ndata: hello\ndata: world\n\n" +
+		"data: {\"n\":2}\n\n" +
+		": note\n\n"
+	if w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	w := serveSSE(func(b Bits) error {
+		if _, err := b.SSE(SSEHeartbeat(5 * time.Millisecond)); err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}, nil)
+	if !strings.Contains(w.Body.String(), ":\n\n") {
+		t.Errorf("body = %q, want heartbeats", w.Body)
+	}
+}
+
+// Errors returned once the stream is open go to SSEOnError, and a second
+// SSE call can't change the options of the open stream.
+func TestSSEHandlerError(t *testing.T) {
+	var got error
+	boom := errors.New("boom")
+	w := serveSSE(func(b Bits) error {
+		s, err := b.SSE(SSEHeartbeat(0), SSEOnError(func(r *http.Request, err error) { got = err }))
+		if err != nil {
+			return err
+		}
+		if again, err := b.SSE(); again != s || err != nil {
+			t.Errorf("SSE() again = %v, %v; want the open stream", again, err)
+		}
+		if _, err := b.SSE(SSERetry(time.Second)); err == nil {
+			t.Error("SSE() with options on an open stream succeeded")
+		}
+		return boom
+	}, nil)
+	if got != boom {
+		t.Errorf("SSEOnError got %v, want %v", got, boom)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("response = %d %q, want the bare stream", w.Code, w.Body)
+	}
+}
+
+func TestSSEBrokerReplay(t *testing.T) {
+	br := NewSSEBroker(SSEBrokerOptions{History: 2})
+	for _, id := range []string{"1", "2", "3"} {
+		br.Publish(SSEEvent{ID: id, Data: "event " + id})
+	}
+
+	w := serveSSE(func(b Bits) error {
+		s, err := b.SSE(SSEHeartbeat(0))
+		if err != nil {
+			return err
+		}
+		if s.LastEventID() != "2" {
+			t.Errorf("LastEventID() = %q, want 2", s.LastEventID())
+		}
+		sub := br.Subscribe(s.LastEventID())
+		defer sub.Close()
+		ev := <-sub.Events()
+		return s.Send(ev.Event, ev.ID, ev.Data)
+	}, http.Header{"Last-Event-Id": {"2"}})
+
+	if want := "id: 3\ndata: event 3\n\n"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body, want)
+	}
+	if sub := br.Subscribe("1"); len(sub.Events()) != 0 {
+		t.Error("replayed from an ID that fell out of the history")
+	}
+}
+
+func TestSSEBrokerDropPolicy(t *testing.T) {
+	drain := func(sub *SSESubscriber) []string {
+		var ids []string
+		for len(sub.Events()) > 0 {
+			ev, ok := <-sub.Events()
+			if !ok {
+				break
+			}
+			ids = append(ids, ev.ID)
+		}
+		return ids
+	}
+
+	for _, tt := range []struct {
+		name   string
+		policy DropPolicy
+		want   []string
+		subs   int
+	}{
+		{"DropNewest", DropNewest, []string{"1", "2"}, 1},
+		{"DropOldest", DropOldest, []string{"2", "3"}, 1},
+		{"DropSubscriber", DropSubscriber, []string{"1", "2"}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			br := NewSSEBroker(SSEBrokerOptions{Buffer: 2, Policy: tt.policy})
+			sub := br.Subscribe("")
+			for _, id := range []string{"1", "2", "3"} {
+				br.Publish(SSEEvent{ID: id})
+			}
+			if got := drain(sub); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+			if sub.Dropped() != 1 {
+				t.Errorf("Dropped() = %d, want 1", sub.Dropped())
+			}
+			if br.Len() != tt.subs {
+				t.Errorf("Len() = %d, want %d", br.Len(), tt.subs)
+			}
+			if tt.policy == DropSubscriber {
+				if _, ok := <-sub.Events(); ok {
+					t.Error("events of a dropped subscriber aren't closed")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package orbit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// StaticOptions configures FileServer and Orbit.Static.
+type StaticOptions struct {
+	// Browse lists the content of directories without an index.html.
+	Browse bool
+
+	// DotFiles serves files and directories whose name starts with a
+	// dot, like .well-known. They are hidden by default, to keep .git or
+	// .env from leaking.
+	DotFiles bool
+
+	// Precompressed serves the .br or .gz sibling of a file, if there is
+	// one and the client accepts that encoding.
+	Precompressed bool
+
+	// CacheControl is the Cache-Control header of the files that aren't
+	// fingerprinted. It isn't set by default.
+	CacheControl string
+
+	// Fingerprinted reports whether a file name holds a hash of its
+	// content, so it can be cached forever. Defaults to names with a hex
+	// hash of 8 or more digits before the extension, like
+	// "app.3f9a1c0b.js" or "app-3f9a1c0b.js".
+	Fingerprinted func(name string) bool
+}
+
+// immutableCacheControl is the Cache-Control of fingerprinted files.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+var fingerprintRegexp = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[^./]+$`)
+
+// Static serves the files of `fsys`, e.g. an embed.FS or os.DirFS, for
+// GET and HEAD requests under `prefix`, e.g.
+//
+//	o.Static("/assets", os.DirFS("public"), orbit.StaticOptions{Precompressed: true})
+func (o *Orbit) Static(prefix string, fsys fs.FS, opts StaticOptions) {
+	if strings.ContainsAny(prefix, "{}*") {
+		panic(fmt.Sprintf("orbit: Static() does not allow URL params in prefix '%s'", prefix))
+	}
+	h := FileServer(fsys, opts)
+	pattern := strings.TrimSuffix(prefix, "/") + "/*"
+	o.Get(pattern, h)
+	o.Head(pattern, h)
+}
+
+// FileServer returns a handler serving the files of `fsys`. The file path
+// is the catch-all URL param of the route, or the request path if there
+// is none.
+//
+// It answers conditional requests with ETag, a hash of the content, and
+// Last-Modified when the file system has modification times, and serves
+// byte ranges. Paths with ".." segments, backslashes or NUL bytes are
+// rejected with a 404 before touching the file system.
+func FileServer(fsys fs.FS, opts StaticOptions) HandlerFunc {
+	return newFileServer(fsys, opts).serve
+}
+
+func newFileServer(fsys fs.FS, opts StaticOptions) *fileServer {
+	if opts.Fingerprinted == nil {
+		opts.Fingerprinted = fingerprintRegexp.MatchString
+	}
+	return &fileServer{fsys: fsys, opts: opts}
+}
+
+type fileServer struct {
+	fsys fs.FS
+	opts StaticOptions
+
+	mu    sync.Mutex
+	etags map[string]fileETag
+}
+
+// fileETag is the ETag of a file, for the size and modification time it
+// was computed for.
+type fileETag struct {
+	size    int64
+	modTime int64
+	etag    string
+}
+
+// maxETags bounds the ETags cached by a file server. The cache starts over
+// once it is full, e.g. with a directory of uploads that keeps growing.
+const maxETags = 4096
+
+func errNotFound() error {
+	return NewHTTPError(http.StatusNotFound, "404 page not found")
+}
+
+func (s *fileServer) serve(b Bits) error {
+	r := b.Request()
+	raw := requestPath(r)
+	if rctx := RouteContext(r.Context()); rctx != nil && contains(rctx.URLParams.Keys, "*") {
+		raw = rctx.URLParam("*")
+	}
+	return s.serveName(b, raw)
+}
+
+// requestPath returns the path of the request, escaped if it has escapes
+// like the paths routed are.
+func requestPath(r *http.Request) string {
+	if r.URL.RawPath != "" {
+		return r.URL.RawPath
+	}
+	return r.URL.Path
+}
+
+// serveName serves the file at `raw`, a path from the request.
+func (s *fileServer) serveName(b Bits, raw string) error {
+	r := b.Request()
+	w := b.Response()
+
+	name, ok := s.cleanName(raw, r.URL.RawPath != "")
+	if !ok {
+		return errNotFound()
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return errNotFound()
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Relative to the directory, so that a path starting with "//"
+			// can't send the client to another host.
+			u := url.URL{Path: path.Base(r.URL.Path) + "/", RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return nil
+		}
+		index := path.Join(name, "index.html")
+		if info, err = fs.Stat(s.fsys, index); err == nil && !info.IsDir() {
+			return s.serveFile(w, r, index, info)
+		}
+		if !s.opts.Browse {
+			return errNotFound()
+		}
+		return s.serveDir(w, name)
+	}
+	return s.serveFile(w, r, name, info)
+}
+
+// cleanName turns the requested path into a name for fs.FS, rejecting
+// anything that could escape it.
+func (s *fileServer) cleanName(p string, escaped bool) (string, bool) {
+	if escaped {
+		var err error
+		if p, err = url.PathUnescape(p); err != nil {
+			return "", false
+		}
+	}
+	if strings.ContainsAny(p, "\\\x00") {
+		return "", false
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." || (!s.opts.DotFiles && strings.HasPrefix(seg, ".") && seg != ".") {
+			return "", false
+		}
+	}
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+func (s *fileServer) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) error {
+	served, encoding := name, ""
+	if s.opts.Precompressed {
+		for _, enc := range [...]struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+			if !acceptsEncoding(r, enc.name) {
+				continue
+			}
+			if ci, err := fs.Stat(s.fsys, name+enc.ext); err == nil && !ci.IsDir() {
+				served, encoding, info = name+enc.ext, enc.name, ci
+				break
+			}
+		}
+	}
+
+	f, err := s.fsys.Open(served)
+	if err != nil {
+		return errNotFound()
+	}
+	defer f.Close()
+
+	hdr := w.Header()
+	if s.opts.Fingerprinted(path.Base(name)) {
+		hdr.Set("Cache-Control", immutableCacheControl)
+	} else if s.opts.CacheControl != "" {
+		hdr.Set("Cache-Control", s.opts.CacheControl)
+	}
+	if s.opts.Precompressed {
+		hdr.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		// The type of the original file, not of the compressed one.
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		hdr.Set("Content-Type", ctype)
+		hdr.Set("Content-Encoding", encoding)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	etag, err := s.etag(served, info, content)
+	if err != nil {
+		return err
+	}
+	hdr.Set("ETag", etag)
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return nil
+}
+
+// etag returns the strong ETag of a file, hashing its content once per
+// size and modification time. Only the last version of each file is kept.
+func (s *fileServer) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	size, modTime := info.Size(), info.ModTime().UnixNano()
+	s.mu.Lock()
+	cached, ok := s.etags[name]
+	s.mu.Unlock()
+	if ok && cached.size == size && cached.modTime == modTime {
+		return cached.etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	s.mu.Lock()
+	if s.etags == nil || (len(s.etags) >= maxETags && !ok) {
+		s.etags = map[string]fileETag{}
+	}
+	s.etags[name] = fileETag{size: size, modTime: modTime, etag: etag}
+	s.mu.Unlock()
+	return etag, nil
+}
+
+func (s *fileServer) serveDir(w http.ResponseWriter, name string) error {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return errNotFound()
+		}
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<meta charset=\"utf-8\">\n<pre>\n")
+	for _, e := range entries {
+		n := e.Name()
+		if !s.opts.DotFiles && strings.HasPrefix(n, ".") {
+			continue
+		}
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	sb.WriteString("</pre>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the
+// request accepts `encoding` with a non zero quality.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), encoding) {
+				continue
+			}
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package orbit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newStaticOrbit(fsys fstest.MapFS, opts StaticOptions) *Orbit {
+	o := NewOrbit()
+	o.Static("/assets", fsys, opts)
+	return o
+}
+
+func getStatic(o *Orbit, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for k, vs := range header {
+		r.Header[k] = vs
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, r)
+	return w
+}
+
+func TestStaticTraversal(t *testing.T) {
+	o := newStaticOrbit(fstest.MapFS{
+		"app.js":      {Data: []byte("app")},
+		".env":        {Data: []byte("SECRET=1")},
+		"sub/page.js": {Data: []byte("page")},
+	}, StaticOptions{})
+
+	for _, target := range []string{
+		"/assets/../static_test.go",
+		"/assets/sub/../../app.js",
+		"/assets/%2e%2e/app.js",
+		"/assets/sub%2f..%2f..%2fapp.js",
+		"/assets/sub%5c..%5capp.js",
+		"/assets/app.js%00",
+		"/assets/.env",
+	} {
+		if w := getStatic(o, target, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d %q, want 404", target, w.Code, w.Body)
+		}
+	}
+	if w := getStatic(o, "/assets/sub/page.js", nil); w.Code != http.StatusOK || w.Body.String() != "page" {
+		t.Errorf("GET /assets/sub/page.js = %d %q", w.Code, w.Body)
+	}
+}
+
+// Directories redirect to their trailing slash relative to themselves, so
+// a path starting with "//" can't send the client to another host.
+func TestStaticDirectoryRedirect(t *testing.T) {
+	o := NewOrbit()
+	o.Get("/*", FileServer(fstest.MapFS{"evil.com/docs/index.html": {Data: []byte("docs")}}, StaticOptions{}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.URL = &url.URL{Path: "//evil.com/docs", RawQuery: "v=1"}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, r)
+	if loc := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || loc != "/evil.com/docs/?v=1" {
+		t.Errorf("redirect = %d %q, want 301 %q", w.Code, loc, "/evil.com/docs/?v=1")
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	o := newStaticOrbit(fstest.MapFS{
+		"app.js":    {Data: []byte("plain")},
+		"app.js.br": {Data: []byte("brotli")},
+		"app.js.gz": {Data: []byte("gzip")},
+		"only.css":  {Data: []byte("css")},
+	}, StaticOptions{Precompressed: true})
+
+	for _, tt := range []struct {
+		target, accept, body, encoding string
+	}{
+		{"/assets/app.js", "gzip, br", "brotli", "br"},
+		{"/assets/app.js", "gzip", "gzip", "gzip"},
+		{"/assets/app.js", "br;q=0, gzip", "gzip", "gzip"},
+		{"/assets/app.js", "", "plain", ""},
+		{"/assets/only.css", "br, gzip", "css", ""},
+	} {
+		w := getStatic(o, tt.target, http.Header{"Accept-Encoding": {tt.accept}})
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("GET %s (Accept-Encoding: %s) = %q %q, want %q %q",
+				tt.target, tt.accept, w.Body, w.Header().Get("Content-Encoding"), tt.body, tt.encoding)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("GET %s: Vary = %q", tt.target, w.Header().Get("Vary"))
+		}
+	}
+	w := getStatic(o, "/assets/app.js", http.Header{"Accept-Encoding": {"br"}})
+	if ct := w.Header().Get("Content-Type"); ct != "text/javascript; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want the type of app.js", ct)
+	}
+}
+
+// The ETag follows the file, and the cache keeps a single entry for it.
+func TestStaticETag(t *testing.T) {
+	fsys := fstest.MapFS{"app.js": {Data: []byte("v1"), ModTime: time.Unix(1, 0)}}
+	s := newFileServer(fsys, StaticOptions{})
+	o := NewOrbit()
+	o.Get("/*", s.serve)
+
+	first := getStatic(o, "/app.js", nil).Header().Get("ETag")
+	if w := getStatic(o, "/app.js", http.Header{"If-None-Match": {first}}); w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want 304", w.Code)
+	}
+
+	fsys["app.js"] = &fstest.MapFile{Data: []byte("v2"), ModTime: time.Unix(2, 0)}
+	if etag := getStatic(o, "/app.js", nil).Header().Get("ETag"); etag == first {
+		t.Error("ETag didn't change with the file")
+	}
+	if n := len(s.etags); n != 1 {
+		t.Errorf("%d cached ETags, want 1", n)
+	}
+}
@@ -108,6 +108,15 @@ type node struct {
 
 	// first byte of the prefix
 	label byte
+
+	// perfect hash of the fully static routes, set on frozen root nodes
+	static *staticTable
+
+	// methods with a handler and methods allowed on the leaf, set by
+	// freeze and valid while frozen is set
+	methods methodTyp
+	allowed methodTyp
+	frozen  bool
 }
 
 // endpoints is a mapping of http method constants to handlers
@@ -123,6 +132,9 @@ type endpoint struct {
 
 	// parameter keys recorded on handler nodes
 	paramKeys []string
+
+	// metadata attached when the route was registered
+	meta *RouteMeta
 }
 
 func (s endpoints) Value(method methodTyp) *endpoint {
@@ -341,6 +353,7 @@ func (n *node) getEdge(ntyp nodeTyp, label, tail byte, prefix string) *node {
 
 func (n *node) setEndpoint(method methodTyp, handler Handler, pattern string) {
 	// Set the handler for the method type on the node
+	n.frozen = false
 	if n.endpoints == nil {
 		n.endpoints = make(endpoints)
 	}
@@ -352,28 +365,68 @@ func (n *node) setEndpoint(method methodTyp, handler Handler, pattern string) {
 	}
 	if method&mALL == mALL {
 		h := n.endpoints.Value(mALL)
-		h.handler = handler
+		h.handler = mergeVariants(h.handler, h.meta, handler)
 		h.pattern = pattern
 		h.paramKeys = paramKeys
 		for _, m := range methodMap {
 			h := n.endpoints.Value(m)
-			h.handler = handler
+			h.handler = mergeVariants(h.handler, h.meta, handler)
 			h.pattern = pattern
 			h.paramKeys = paramKeys
 		}
 	} else {
 		h := n.endpoints.Value(method)
-		h.handler = handler
+		h.handler = mergeVariants(h.handler, h.meta, handler)
 		h.pattern = pattern
 		h.paramKeys = paramKeys
 	}
 }
 
+// setMeta attaches `meta` to the endpoints set for `method`, following the
+// same rules as setEndpoint.
+func (n *node) setMeta(method methodTyp, meta *RouteMeta) {
+	n.frozen = false
+	if method&mALL == mALL {
+		n.endpoints.Value(mALL).setMeta(meta)
+		for _, m := range methodMap {
+			n.endpoints.Value(m).setMeta(meta)
+		}
+	} else {
+		n.endpoints.Value(method).setMeta(meta)
+	}
+}
+
+// setMeta attaches `meta` to the endpoint, and to the handler last
+// registered on it when it has handlers with matchers.
+func (e *endpoint) setMeta(meta *RouteMeta) {
+	e.meta = meta
+	if vh, ok := e.handler.(*variantHandler); ok {
+		vh.variants[vh.added].meta = meta
+	}
+}
+
 func (n *node) FindRoute(rctx *Context, method methodTyp, path string) (*node, endpoints, Handler) {
-	// Reset the context routing pattern and params
+	// Reset the context routing pattern, params and allowed methods
 	rctx.routePattern = ""
 	rctx.routeParams.Keys = rctx.routeParams.Keys[:0]
 	rctx.routeParams.Values = rctx.routeParams.Values[:0]
+	rctx.methodNotAllowed = false
+	rctx.methodsAllowed = rctx.methodsAllowed[:0]
+
+	// Fully static routes of a frozen tree are found without walking it.
+	// When the method isn't one of the route, the tree is walked to look
+	// for a param route taking it.
+	if n.static != nil {
+		if e := n.static.lookup(path); e != nil && e.methods&method != 0 {
+			ep := e.node.endpoints[method]
+			rctx.routeMeta = ep.meta
+			if ep.pattern != "" {
+				rctx.routePattern = ep.pattern
+				rctx.RoutePatterns = append(rctx.RoutePatterns, rctx.routePattern)
+			}
+			return e.node, e.node.endpoints, ep.handler
+		}
+	}
 
 	// Find the routing handlers for the path
 	rn := n.findRoute(rctx, method, path)
@@ -385,7 +438,8 @@ func (n *node) FindRoute(rctx *Context, method methodTyp, path string) (*node, e
 	rctx.URLParams.Keys = append(rctx.URLParams.Keys, rctx.routeParams.Keys...)
 	rctx.URLParams.Values = append(rctx.URLParams.Values, rctx.routeParams.Values...)
 
-	// Record the routing pattern in the request lifecycle
+	// Record the routing metadata and pattern in the request lifecycle
+	rctx.routeMeta = rn.endpoints[method].meta
 	if rn.endpoints[method].pattern != "" {
 		rctx.routePattern = rn.endpoints[method].pattern
 		rctx.RoutePatterns = append(rctx.RoutePatterns, rctx.routePattern)
@@ -418,7 +472,12 @@ func (n *node) findRoute(rctx *Context, method methodTyp, path string) *node {
 		case ntStatic:
 			xn = nds.findEdge(label)
 			if xn == nil || !strings.HasPrefix(xsearch, xn.prefix) {
-				continue
+				if !rctx.foldCase {
+					continue
+				}
+				if xn = nds.findFoldEdge(xsearch); xn == nil {
+					continue
+				}
 			}
 			xsearch = xsearch[len(xn.prefix):]
 
@@ -458,25 +517,8 @@ func (n *node) findRoute(rctx *Context, method methodTyp, path string) *node {
 				rctx.routeParams.Values = append(rctx.routeParams.Values, xsearch[:p])
 				xsearch = xsearch[p:]
 
-				if len(xsearch) == 0 {
-					if xn.isLeaf() {
-						h := xn.endpoints[method]
-						if h != nil && h.handler != nil {
-							rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
-							return xn
-						}
-
-						for endpoints := range xn.endpoints {
-							if endpoints == mALL || endpoints == mSTUB {
-								continue
-							}
-							rctx.methodsAllowed = append(rctx.methodsAllowed, endpoints)
-						}
-
-						// flag that the routing context found a route, but not a corresponding
-						// supported method
-						rctx.methodNotAllowed = true
-					}
+				if len(xsearch) == 0 && xn.isLeaf() && xn.matchMethod(rctx, method) {
+					return xn
 				}
 
 				// recursively find the next node on this branch
@@ -504,25 +546,8 @@ func (n *node) findRoute(rctx *Context, method methodTyp, path string) *node {
 		}
 
 		// did we find it yet?
-		if len(xsearch) == 0 {
-			if xn.isLeaf() {
-				h := xn.endpoints[method]
-				if h != nil && h.handler != nil {
-					rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
-					return xn
-				}
-
-				for endpoints := range xn.endpoints {
-					if endpoints == mALL || endpoints == mSTUB {
-						continue
-					}
-					rctx.methodsAllowed = append(rctx.methodsAllowed, endpoints)
-				}
-
-				// flag that the routing context found a route, but not a corresponding
-				// supported method
-				rctx.methodNotAllowed = true
-			}
+		if len(xsearch) == 0 && xn.isLeaf() && xn.matchMethod(rctx, method) {
+			return xn
 		}
 
 		// recursively find the next node..
@@ -543,6 +568,36 @@ func (n *node) findRoute(rctx *Context, method methodTyp, path string) *node {
 	return nil
 }
 
+// matchMethod reports whether the leaf has a handler for `method`, adding
+// its param keys. Otherwise it records the methods allowed on the leaf.
+func (n *node) matchMethod(rctx *Context, method methodTyp) bool {
+	if n.frozen {
+		if n.methods&method != 0 {
+			rctx.routeParams.Keys = append(rctx.routeParams.Keys, n.endpoints[method].paramKeys...)
+			return true
+		}
+		rctx.methodsAllowed = appendMethods(rctx.methodsAllowed, n.allowed)
+	} else {
+		h := n.endpoints[method]
+		if h != nil && h.handler != nil {
+			rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
+			return true
+		}
+
+		for endpoints := range n.endpoints {
+			if endpoints == mALL || endpoints == mSTUB {
+				continue
+			}
+			rctx.methodsAllowed = append(rctx.methodsAllowed, endpoints)
+		}
+	}
+
+	// flag that the routing context found a route, but not a corresponding
+	// supported method
+	rctx.methodNotAllowed = true
+	return false
+}
+
 func (n *node) findEdge(ntyp nodeTyp, label byte) *node {
 	nds := n.children[ntyp]
 	num := len(nds)
@@ -642,8 +697,10 @@ func (n *node) routes() []Route {
 
 		for p, mh := range pats {
 			hs := make(map[string]Handler)
+			ms := make(map[string]*RouteMeta)
 			if mh[mALL] != nil && mh[mALL].handler != nil {
 				hs["*"] = mh[mALL].handler
+				ms["*"] = mh[mALL].meta
 			}
 
 			for mt, h := range mh {
@@ -655,9 +712,10 @@ func (n *node) routes() []Route {
 					continue
 				}
 				hs[m] = h.handler
+				ms[m] = h.meta
 			}
 
-			rt := Route{subroutes, hs, p}
+			rt := Route{SubRoutes: subroutes, Handlers: hs, Meta: ms, Pattern: p}
 			rts = append(rts, rt)
 		}
 
@@ -843,25 +901,78 @@ func (ns nodes) findEdge(label byte) *node {
 type Route struct {
 	SubRoutes Routes
 	Handlers  map[string]Handler
+	Meta      map[string]*RouteMeta
 	Pattern   string
+
+	// Host is the host pattern routing to this route, set by Hosts.
+	Host string
+
+	// Versions are the API versions serving this route, set by Versions.
+	Versions []string
 }
 
 // WalkFunc is the type of the function called for each method and route visited by Walk.
 type WalkFunc func(method string, route string, handler Handler, middlewares ...func(Handler) Handler) error
 
+// RouteInfo describes a single method and route visited by WalkRoutes.
+type RouteInfo struct {
+	Method      string
+	Host        string
+	Route       string
+	Handler     Handler
+	Middlewares []func(Handler) Handler
+	Meta        *RouteMeta
+
+	// Matchers describes the matchers the route was registered with
+	// using When. Routes with several handlers on the same method are
+	// visited once per handler.
+	Matchers []string
+
+	// Versions are the API versions serving the route, fallbacks
+	// included, when it is routed by Versions.
+	Versions []string
+	// Policies are the names of the policies guarding the route, in the
+	// order they are checked: those of the Require and Authorize
+	// middlewares, then those declared on the route with
+	// RouteHandle.Require and RouteHandle.Authorize.
+	Policies []string
+
+	// handler is the handler as registered, its inline middlewares
+	// included.
+	handler Handler
+}
+
 // Walk walks any router tree that implements Routes interface.
 func Walk(r Routes, walkFn WalkFunc) error {
-	return walk(r, walkFn, "")
+	return WalkRoutes(r, func(ri RouteInfo) error {
+		return walkFn(ri.Method, ri.Route, ri.Handler, ri.Middlewares...)
+	})
+}
+
+// WalkRoutes walks any router tree that implements Routes interface, like
+// Walk, passing the full details of every route including its metadata.
+func WalkRoutes(r Routes, fn func(ri RouteInfo) error) error {
+	return walk(r, fn, "", "", nil)
 }
 
-func walk(r Routes, walkFn WalkFunc, parentRoute string, parentMw ...func(Handler) Handler) error {
+func walk(r Routes, fn func(ri RouteInfo) error, host, parentRoute string, parentPolicies []string, parentMw ...func(Handler) Handler) error {
+	policies := parentPolicies
+	if o, ok := r.(*Orbit); ok {
+		policies = appendPolicyNames(policies[:len(policies):len(policies)], o.policies)
+	}
+
 	for _, route := range r.Routes() {
+		host := host
+		if route.Host != "" {
+			host = route.Host
+		}
+
 		mws := make([]func(Handler) Handler, len(parentMw))
 		copy(mws, parentMw)
 		mws = append(mws, r.Middlewares()...)
 
 		if route.SubRoutes != nil {
-			if err := walk(route.SubRoutes, walkFn, parentRoute+route.Pattern, mws...); err != nil {
+			if err := walk(route.SubRoutes, fn, host, parentRoute+route.Pattern, policies, mws...); err != nil {
 				return err
 			}
 			continue
@@ -876,12 +987,28 @@ func walk(r Routes, walkFn WalkFunc, parentRoute string, parentMw ...func(Handle
 			fullRoute := parentRoute + route.Pattern
 			fullRoute = strings.Replace(fullRoute, "/*/", "/", -1)
 
-			if chain, ok := handler.(*ChainHandler); ok {
-				if err := walkFn(method, fullRoute, chain.Endpoint, append(mws, chain.Middlewares...)...); err != nil {
-					return err
+			vs := []*variant{{handler: handler, meta: route.Meta[method]}}
+			if vh, ok := handler.(*variantHandler); ok {
+				vs = vh.variants
+			}
+			for _, v := range vs {
+				ri := RouteInfo{Method: method, Host: host, Route: fullRoute, Handler: v.handler, Middlewares: mws, Meta: v.meta, Versions: route.Versions, Policies: policies}
+				ri.handler = v.handler
+				if chain, ok := v.handler.(*ChainHandler); ok {
+					ri.Handler = chain.Endpoint
+					ri.Middlewares = append(mws[:len(mws):len(mws)], chain.Middlewares...)
+					ri.Policies = append(policies[:len(policies):len(policies)], chain.policies...)
 				}
-			} else {
-				if err := walkFn(method, fullRoute, handler, mws...); err != nil {
+				if g, ok := ri.Handler.(*routeGuard); ok {
+					ri.Handler = g.next
+				}
+				if v.meta != nil {
+					ri.Policies = appendPolicyNames(ri.Policies[:len(ri.Policies):len(ri.Policies)], v.meta.Policies)
+				}
+				for _, m := range v.matchers {
+					ri.Matchers = append(ri.Matchers, m.Name)
+				}
+				if err := fn(ri); err != nil {
 					return err
 				}
 			}
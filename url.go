@@ -0,0 +1,158 @@
+package orbit
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// URL builds the path of the route named `name`, filling its URL params
+// from `params` key/value pairs, e.g.
+//
+//	o.URL("order.show", "id", "42")
+//
+// Routes named inside mounted sub-routers are found too, with the mount
+// patterns prepended. The catch-all param is filled with the "*" key.
+// Values are path escaped and checked against regexp params in the form
+// the router matches them.
+// It panics if the name is registered in more than one mounted router.
+func (o *Orbit) URL(name string, params ...string) (string, error) {
+	m := o.owner()
+	unlock := m.rlock()
+	pattern, ok := m.namedPattern(name)
+	unlock()
+	if !ok {
+		return "", fmt.Errorf("orbit: no route named '%s'", name)
+	}
+	return buildURL(pattern, params)
+}
+
+// namedPattern returns the full pattern of the route named `name`,
+// searching mounted sub-routers too. It panics if the name is registered
+// in more than one of them, as either route could be meant.
+func (o *Orbit) namedPattern(name string) (string, bool) {
+	var found []string
+	o.walkNames("", func(n, pattern string) {
+		if n == name {
+			found = append(found, pattern)
+		}
+	})
+	if len(found) > 1 {
+		panic(fmt.Sprintf("orbit: route name '%s' is registered more than once, for '%s' and '%s'", name, found[0], found[1]))
+	}
+	if len(found) == 0 {
+		return "", false
+	}
+	return found[0], true
+}
+
+// checkNames panics if a route name is registered more than once across
+// the router and its mounted sub-routers.
+func (o *Orbit) checkNames() {
+	seen := map[string]string{}
+	o.walkNames("", func(name, pattern string) {
+		if p, ok := seen[name]; ok {
+			panic(fmt.Sprintf("orbit: route name '%s' is registered more than once, for '%s' and '%s'", name, p, pattern))
+		}
+		seen[name] = pattern
+	})
+}
+
+// walkNames calls fn with every route name of the router and of its
+// mounted sub-routers, along with the full pattern of the route.
+func (o *Orbit) walkNames(prefix string, fn func(name, pattern string)) {
+	for name, p := range o.names {
+		fn(name, prefix+p)
+	}
+	for _, rt := range o.root().routes() {
+		if sub, ok := rt.SubRoutes.(*Orbit); ok {
+			sub.walkNames(prefix+strings.TrimSuffix(rt.Pattern, "/*"), fn)
+		}
+	}
+}
+
+// rexCache holds compiled regexp params used to validate URL values.
+var rexCache sync.Map
+
+// urlCheck is a regexp param to check once the URL is built.
+type urlCheck struct {
+	rex            *regexp.Regexp
+	param          string
+	value, escaped string
+}
+
+func buildURL(pattern string, params []string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("orbit: URL params for '%s' must be key/value pairs", pattern)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	var (
+		sb     strings.Builder
+		checks []urlCheck
+	)
+	pat := pattern
+	for {
+		typ, key, rexpat, _, ps, pe := patNextSegment(pat)
+		if typ == ntStatic {
+			sb.WriteString(pat)
+			break
+		}
+		sb.WriteString(pat[:ps])
+
+		v, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("orbit: missing URL param '%s' for '%s'", key, pattern)
+		}
+		delete(values, key)
+
+		if typ == ntCatchAll {
+			segs := strings.Split(v, "/")
+			for i, seg := range segs {
+				segs[i] = url.PathEscape(seg)
+			}
+			sb.WriteString(strings.Join(segs, "/"))
+			break
+		}
+
+		if v == "" || strings.IndexByte(v, '/') >= 0 {
+			return "", fmt.Errorf("orbit: invalid value '%s' for URL param '%s'", v, key)
+		}
+		esc := url.PathEscape(v)
+		if typ == ntRegexp {
+			rex, ok := rexCache.Load(rexpat)
+			if !ok {
+				rex, _ = rexCache.LoadOrStore(rexpat, regexp.MustCompile(rexpat))
+			}
+			checks = append(checks, urlCheck{rex.(*regexp.Regexp), pat[ps:pe], v, esc})
+		}
+		sb.WriteString(esc)
+		pat = pat[pe:]
+	}
+
+	// The router matches the raw path of a request when its escaping
+	// isn't the default one, and the decoded path otherwise: the regexp
+	// params are checked against the form the router will see.
+	built := sb.String()
+	decoded, _ := url.PathUnescape(built)
+	raw := (&url.URL{Path: decoded}).EscapedPath() != built
+	for _, c := range checks {
+		v := c.value
+		if raw {
+			v = c.escaped
+		}
+		if !c.rex.MatchString(v) {
+			return "", fmt.Errorf("orbit: value '%s' doesn't match URL param '%s'", v, c.param)
+		}
+	}
+
+	for key := range values {
+		return "", fmt.Errorf("orbit: unknown URL param '%s' for '%s'", key, pattern)
+	}
+	return built, nil
+}
@@ -0,0 +1,94 @@
+package orbit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLMounted(t *testing.T) {
+	api := NewOrbit()
+	api.Get("/orders/{id:[0-9]+}", func(b Bits) error { return b.Text(200, URLParam(b.Request(), "id")) }).Name("order.show")
+	api.Get("/files/*", func(b Bits) error { return nil }).Name("file")
+	o := NewOrbit()
+	o.Mount("/api", api)
+
+	u, err := o.URL("order.show", "id", "42")
+	if err != nil || u != "/api/orders/42" {
+		t.Fatalf("URL = %q, %v", u, err)
+	}
+	w := httptest.NewRecorder()
+	o.ServeHTTP(w, httptest.NewRequest("GET", u, nil))
+	if w.Code != 200 || w.Body.String() != "42" {
+		t.Errorf("GET %s = %d %q", u, w.Code, w.Body.String())
+	}
+
+	if u, err := o.URL("file", "*", "a b/c.txt"); err != nil || u != "/api/files/a%20b/c.txt" {
+		t.Errorf("URL = %q, %v", u, err)
+	}
+	if _, err := o.URL("order.show", "id", "x"); err == nil {
+		t.Error("URL accepted a value not matching the regexp param")
+	}
+	if _, err := o.URL("order.show"); err == nil {
+		t.Error("URL accepted a missing param")
+	}
+}
+
+// The regexp is checked against the value the router will match: the
+// decoded one for a default escaping, and the escaped one otherwise.
+func TestURLRegexpRouted(t *testing.T) {
+	o := NewOrbit()
+	o.Get("/tags/{tag:[a-z ]+}", func(b Bits) error { return nil }).Name("tag")
+	o.Get("/lists/{list:[a-z,]+}", func(b Bits) error { return nil }).Name("list")
+	o.Get("/search/{q:[a-z%0-9A-F]+}", func(b Bits) error { return nil }).Name("search")
+
+	for _, tt := range []struct {
+		name, key, value, want string
+	}{
+		{"tag", "tag", "a b", "/tags/a%20b"},
+		{"list", "list", "a,b", ""},
+		{"search", "q", "a,b", "/search/a%2Cb"},
+	} {
+		u, err := o.URL(tt.name, tt.key, tt.value)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("URL(%s) = %q, the router wouldn't match it", tt.name, u)
+			}
+			continue
+		}
+		if err != nil || u != tt.want {
+			t.Errorf("URL(%s) = %q, %v, want %q", tt.name, u, err, tt.want)
+			continue
+		}
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, httptest.NewRequest("GET", u, nil))
+		if w.Code != 200 {
+			t.Errorf("GET %s = %d", u, w.Code)
+		}
+	}
+}
+
+func TestURLDuplicateNames(t *testing.T) {
+	mustPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s didn't panic on a duplicate route name", name)
+			}
+		}()
+		fn()
+	}
+
+	mustPanic("Mount", func() {
+		o, sub := NewOrbit(), NewOrbit()
+		o.Get("/", func(b Bits) error { return nil }).Name("home")
+		sub.Get("/", func(b Bits) error { return nil }).Name("home")
+		o.Mount("/sub", sub)
+	})
+
+	// A name added after the mount is caught when it is looked up.
+	o, sub := NewOrbit(), NewOrbit()
+	o.Get("/", func(b Bits) error { return nil }).Name("home")
+	o.Mount("/sub", sub)
+	sub.Get("/", func(b Bits) error { return nil }).Name("home")
+	mustPanic("URL", func() { o.URL("home") })
+}
@@ -0,0 +1,430 @@
+package orbit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RouteIssue is a problem with the routing table found by Validate or
+// strict mode.
+type RouteIssue struct {
+	// Severity is "error" for routes that are overwritten or can never be
+	// reached, and "warning" for routes that overlap in surprising ways.
+	Severity string
+
+	// Kind is one of "duplicate", "mount-overlap", "unreachable",
+	// "ambiguous" or "catch-all-overlap".
+	Kind string
+
+	// Pattern is the full routing pattern of the offending route,
+	// including the patterns of the routers it is mounted on.
+	Pattern string
+
+	Message string
+}
+
+func (i RouteIssue) String() string {
+	return fmt.Sprintf("%s: %s '%s': %s", i.Severity, i.Kind, i.Pattern, i.Message)
+}
+
+// RouteReport lists the issues found in a routing table.
+type RouteReport []RouteIssue
+
+// Errors returns the issues with "error" severity.
+func (r RouteReport) Errors() RouteReport {
+	var errs RouteReport
+	for _, i := range r {
+		if i.Severity == "error" {
+			errs = append(errs, i)
+		}
+	}
+	return errs
+}
+
+// Err returns an error describing every "error" issue, or nil if there are
+// none.
+func (r RouteReport) Err() error {
+	errs := r.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New("orbit: invalid routes:\n" + errs.String())
+}
+
+func (r RouteReport) String() string {
+	lines := make([]string, len(r))
+	for i, issue := range r {
+		lines[i] = "  " + issue.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Strict enables strict mode on the router: any registration that
+// overwrites an existing route, can never match or overlaps a mounted
+// sub-router panics with a detailed report instead of being accepted
+// quietly. Each registration is checked against the routes it meets in the
+// tree, the whole table is checked again by Freeze, and so by Launch. It
+// should be called before any route is registered.
+func (o *Orbit) Strict(enabled bool) {
+	o.owner().strict = enabled
+}
+
+// StrictReport enables strict mode on the router, handing the errors of
+// every rejected registration to `fn` instead of panicking, e.g. to log
+// them all at startup or fail a test with the full list. The registration
+// then goes through as it would without strict mode. A nil `fn` turns
+// strict mode back to panicking.
+func (o *Orbit) StrictReport(fn func(errs RouteReport)) {
+	m := o.owner()
+	m.strict = true
+	m.strictReport = fn
+}
+
+// Validate audits the whole routing table, mounted sub-routers included,
+// and reports duplicate registrations, routes shadowed by an earlier
+// sibling, ambiguous params and routes overlapping a mount.
+func (o *Orbit) Validate() RouteReport {
+	defer o.owner().rlock()()
+	return o.report("")
+}
+
+// report is Validate for a locked router, with the patterns starting with
+// the `prefix` the router is mounted on.
+func (o *Orbit) report(prefix string) RouteReport {
+	report := o.owner().validate(prefix)
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Pattern < report[j].Pattern
+	})
+	return report
+}
+
+// registration records a pattern registered on a router, used to detect
+// duplicates that the tree itself would silently overwrite.
+type registration struct {
+	pattern string
+	method  methodTyp
+
+	// when describes the matchers of the route, registrations with
+	// different matchers don't overwrite each other.
+	when string
+}
+
+// duplicate returns an issue if `method` was already registered with the
+// matchers described by `when` on a pattern equivalent to `pattern`, i.e.
+// one that only differs by param names.
+func (o *Orbit) duplicate(method methodTyp, pattern, when string) *RouteIssue {
+	o = o.owner()
+	for _, reg := range o.registrations[normalizePattern(pattern)] {
+		if reg.method&method&^mSTUB == 0 || reg.when != when {
+			continue
+		}
+		issue := &RouteIssue{Severity: "error", Kind: "duplicate", Pattern: pattern}
+		switch {
+		case method&mSTUB != 0 || reg.method&mSTUB != 0:
+			issue.Kind = "mount-overlap"
+			issue.Message = fmt.Sprintf("overlaps the mount on '%s'", reg.pattern)
+		case reg.pattern == pattern:
+			issue.Message = fmt.Sprintf("%s is already registered", methodsString(reg.method&method))
+		default:
+			issue.Message = fmt.Sprintf("%s is already registered as '%s'", methodsString(reg.method&method), reg.pattern)
+		}
+		return issue
+	}
+	return nil
+}
+
+// register records the registration of `method` and `pattern` with the
+// matchers described by `when`, once it has been checked.
+func (o *Orbit) register(method methodTyp, pattern, when string) {
+	o = o.owner()
+	if o.registrations == nil {
+		o.registrations = map[string][]registration{}
+	}
+	key := normalizePattern(pattern)
+	o.registrations[key] = append(o.registrations[key], registration{pattern: pattern, method: method, when: when})
+}
+
+// checkStrict fails strict mode with `issue`, if strict mode is enabled.
+func (o *Orbit) checkStrict(issue *RouteIssue) {
+	if issue != nil && o.owner().strict {
+		o.strictFail("orbit: strict mode: "+issue.String(), RouteReport{*issue})
+	}
+}
+
+// strictFail hands `errs` to the function set with StrictReport, or else
+// panics with `msg`.
+func (o *Orbit) strictFail(msg string, errs RouteReport) {
+	if fn := o.owner().strictReport; fn != nil {
+		fn(errs)
+		return
+	}
+	panic(msg)
+}
+
+// checkStrictRoute panics with the errors involving the route of `pattern`
+// in `tree`, if strict mode is enabled. Only the siblings along the route
+// are inspected, the whole table is left to Validate and Freeze.
+func (o *Orbit) checkStrictRoute(tree *node, pattern string) {
+	if !o.owner().strict {
+		return
+	}
+	var errs RouteReport
+	for _, n := range tree.patternPath(pattern) {
+		errs = append(errs, n.validateChildren("", false)...)
+	}
+	if len(errs) > 0 {
+		o.strictFail("orbit: strict mode, invalid routes:\n"+errs.String(), errs)
+	}
+}
+
+// checkStrictReport panics with the errors in the report of the router
+// mounted on `prefix`, if strict mode is enabled.
+func (o *Orbit) checkStrictReport(prefix string) {
+	if !o.owner().strict {
+		return
+	}
+	if errs := o.report(prefix).Errors(); len(errs) > 0 {
+		o.strictFail("orbit: strict mode, invalid routes:\n"+errs.String(), errs)
+	}
+}
+
+func (o *Orbit) validate(prefix string) RouteReport {
+	var report RouteReport
+
+	keys := make([]string, 0, len(o.registrations))
+	for k := range o.registrations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		seen := map[string]methodTyp{}
+		var names []string
+		for _, reg := range o.registrations[k] {
+			if reg.method&seen[reg.when]&^mSTUB != 0 {
+				kind := "duplicate"
+				if reg.method&mSTUB != 0 || seen[reg.when]&mSTUB != 0 {
+					kind = "mount-overlap"
+				}
+				report = append(report, RouteIssue{
+					Severity: "error", Kind: kind, Pattern: prefix + reg.pattern,
+					Message: "overwrites an earlier registration",
+				})
+			}
+			seen[reg.when] |= reg.method
+			if !contains(names, reg.pattern) {
+				names = append(names, reg.pattern)
+			}
+		}
+		if len(names) > 1 {
+			report = append(report, RouteIssue{
+				Severity: "warning", Kind: "ambiguous", Pattern: prefix + names[len(names)-1],
+				Message: fmt.Sprintf("shares its tree node with '%s' but uses different param names", names[0]),
+			})
+		}
+	}
+
+	report = append(report, o.root().validate(prefix)...)
+
+	for _, rt := range o.root().routes() {
+		if sub, ok := rt.SubRoutes.(*Orbit); ok {
+			report = append(report, sub.validate(prefix+strings.TrimSuffix(rt.Pattern, "/*"))...)
+		}
+	}
+	return report
+}
+
+// validate inspects the children of every node for siblings that shadow
+// or overlap each other, following the order findRoute tries them in.
+func (n *node) validate(prefix string) RouteReport {
+	report := n.validateChildren(prefix, true)
+	for _, nds := range n.children {
+		for _, cn := range nds {
+			report = append(report, cn.validate(prefix)...)
+		}
+	}
+	return report
+}
+
+// validateChildren inspects the children of the node, and leaves out the
+// warnings unless `warnings` is set.
+func (n *node) validateChildren(prefix string, warnings bool) RouteReport {
+	var report RouteReport
+
+	regexps, params := n.children[ntRegexp], n.children[ntParam]
+	for i, rn := range regexps {
+		if !universalRegexp(rn.rex) {
+			continue
+		}
+		shadow := "{" + rn.prefix + "}"
+		for _, later := range regexps[i+1:] {
+			if later.tail != rn.tail {
+				continue
+			}
+			for _, p := range later.patterns() {
+				report = append(report, RouteIssue{
+					Severity: "error", Kind: "unreachable", Pattern: prefix + p,
+					Message: fmt.Sprintf("regexp param '%s' is shadowed by an earlier sibling '%s' matching any segment", later.prefix, shadow),
+				})
+			}
+		}
+		for _, pn := range params {
+			if pn.tail != rn.tail {
+				continue
+			}
+			for _, p := range pn.patterns() {
+				report = append(report, RouteIssue{
+					Severity: "error", Kind: "unreachable", Pattern: prefix + p,
+					Message: fmt.Sprintf("param is shadowed by the sibling regexp param '%s' matching any segment", shadow),
+				})
+			}
+		}
+	}
+
+	if warnings {
+		for _, rn := range regexps {
+			for _, pn := range params {
+				if pn.tail != rn.tail {
+					continue
+				}
+				for _, p := range pn.patterns() {
+					report = append(report, RouteIssue{
+						Severity: "warning", Kind: "ambiguous", Pattern: prefix + p,
+						Message: fmt.Sprintf("overlaps the sibling regexp param '%s', which is tried first", rn.prefix),
+					})
+				}
+			}
+		}
+	}
+
+	if cas := n.children[ntCatchAll]; len(cas) > 0 {
+		ca := cas[0]
+		mount := ca.subroutes != nil || (ca.endpoints != nil && ca.endpoints[mSTUB] != nil)
+		for t := ntStatic; t < ntCatchAll && (mount || warnings); t++ {
+			for _, cn := range n.children[t] {
+				for _, p := range cn.patterns() {
+					if mount {
+						report = append(report, RouteIssue{
+							Severity: "error", Kind: "mount-overlap", Pattern: prefix + p,
+							Message: "is registered under a mounted sub-router and takes precedence over its routes",
+						})
+					} else {
+						report = append(report, RouteIssue{
+							Severity: "warning", Kind: "catch-all-overlap", Pattern: prefix + p,
+							Message: "overlaps a sibling catch-all route, which only gets what it doesn't match",
+						})
+					}
+				}
+			}
+		}
+	}
+	return report
+}
+
+// patternPath returns the nodes from `n` down to the node of `pattern`,
+// following the edges InsertRoute took for it.
+func (n *node) patternPath(pattern string) []*node {
+	path := []*node{n}
+	search := pattern
+	for search != "" {
+		label := search[0]
+		var segTyp nodeTyp
+		var segRexpat string
+		var segTail byte
+		var segEndIdx int
+		if label == '{' || label == '*' {
+			segTyp, _, segRexpat, segTail, _, segEndIdx = patNextSegment(search)
+		}
+		var prefix string
+		if segTyp == ntRegexp {
+			prefix = segRexpat
+		}
+
+		if n = n.getEdge(segTyp, label, segTail, prefix); n == nil {
+			break
+		}
+		path = append(path, n)
+		if n.typ > ntStatic {
+			search = search[segEndIdx:]
+		} else if strings.HasPrefix(search, n.prefix) {
+			search = search[len(n.prefix):]
+		} else {
+			break
+		}
+	}
+	return path
+}
+
+// patterns returns the unique endpoint patterns in the sub-tree of a node.
+func (n *node) patterns() []string {
+	var pats []string
+	n.walk(func(eps endpoints, _ Routes) bool {
+		for _, ep := range eps {
+			if ep.pattern != "" && !contains(pats, ep.pattern) {
+				pats = append(pats, ep.pattern)
+			}
+		}
+		return false
+	})
+	sort.Strings(pats)
+	return pats
+}
+
+// normalizePattern drops param names from a pattern, so that patterns
+// which end up on the same tree node compare equal.
+func normalizePattern(pattern string) string {
+	var sb strings.Builder
+	pat := pattern
+	for {
+		typ, _, rexpat, _, ps, pe := patNextSegment(pat)
+		if typ == ntStatic {
+			sb.WriteString(pat)
+			return sb.String()
+		}
+		sb.WriteString(pat[:ps])
+		switch typ {
+		case ntRegexp:
+			sb.WriteString("{:" + rexpat + "}")
+		case ntParam:
+			sb.WriteString("{}")
+		default:
+			sb.WriteString("*")
+		}
+		pat = pat[pe:]
+	}
+}
+
+// universalProbes are segment values a regexp has to match to be
+// considered as matching any segment.
+var universalProbes = []string{"a", "Z", "0", "-", "_", "~", ".", "a.b", "x-1", "%20", "é", "0123456789abcdef"}
+
+// universalRegexp reports whether a regexp param matches any path segment.
+// It's a heuristic based on probe values, good enough to catch the usual
+// `.+` and `[^/]+` suspects.
+func universalRegexp(rex *regexp.Regexp) bool {
+	if rex == nil {
+		return false
+	}
+	for _, p := range universalProbes {
+		if !rex.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func methodsString(method methodTyp) string {
+	if method&mALL == mALL {
+		return "every method"
+	}
+	var names []string
+	for name, m := range methodMap {
+		if method&m != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,38 @@
+package orbit
+
+import "testing"
+
+// A registration rejected by strict mode leaves no trace in the table.
+func TestStrictRejected(t *testing.T) {
+	h := func(b Bits) error { return nil }
+	o := NewOrbit()
+	o.Strict(true)
+	o.Get("/users/{id}", h)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("duplicate route didn't panic")
+			}
+		}()
+		o.Get("/users/{userID}", h)
+	}()
+
+	if errs := o.Validate().Errors(); len(errs) > 0 {
+		t.Errorf("Validate() after a rejected route:\n%s", errs)
+	}
+}
+
+func TestStrictReport(t *testing.T) {
+	h := func(b Bits) error { return nil }
+	var got RouteReport
+	o := NewOrbit()
+	o.StrictReport(func(errs RouteReport) { got = append(got, errs...) })
+	o.Get("/users/{id}", h)
+	o.Get("/users/{userID}", h)
+	o.Post("/users", h)
+
+	if len(got) != 1 || got[0].Kind != "duplicate" || got[0].Pattern != "/users/{userID}" {
+		t.Errorf("report = %v, want the duplicate of /users/{id}", got)
+	}
+}
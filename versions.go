@@ -0,0 +1,379 @@
+package orbit
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Routes = &Versions{}
+
+// VersionOptions configures how Versions reads the API version requested.
+// The strategies are tried in order: path, header, then media type. A
+// request that doesn't ask for a version is served by the default one.
+type VersionOptions struct {
+	// Path reads the version from a path prefix, e.g. "/v2/users".
+	Path bool
+
+	// Header is the request header holding the version, e.g.
+	// "API-Version: 2". Requests asking for an unknown version this way
+	// fail with a 400.
+	Header string
+
+	// MediaType is the vendor media type, e.g. "vnd.acme" to read the
+	// version from "Accept: application/vnd.acme.v2+json". Requests only
+	// accepting unknown versions this way fail with a 406.
+	MediaType string
+
+	// Default is the version serving requests that don't ask for one.
+	// Defaults to the latest version. It must be registered by the time
+	// the router is mounted, added to Hosts or launched.
+	Default string
+
+	// Fallback serves the routes a version doesn't implement with the
+	// previous versions, most recent first, e.g. v3 falls through to v2.
+	Fallback bool
+}
+
+// Versions is a router that dispatches requests to version specific
+// routers, e.g.
+//
+//	api := orbit.NewVersions(orbit.VersionOptions{Path: true, Header: "API-Version", Fallback: true})
+//	api.Version("1", v1).Deprecate(deprecatedAt).Sunset(sunsetAt, "https://example.com/migrate")
+//	api.Version("2", v2)
+//	o.Mount("/api", api)
+//
+// Versions must be registered from the oldest to the latest. Responses of
+// deprecated versions carry the Deprecation, Sunset and Link headers of
+// RFC 9745 and RFC 8594.
+type Versions struct {
+	opts     VersionOptions
+	versions []*APIVersion
+	pool     *sync.Pool
+}
+
+// APIVersion is a version registered on Versions.
+type APIVersion struct {
+	name       string
+	handler    Handler
+	deprecated time.Time
+	sunset     time.Time
+	link       string
+}
+
+// NewVersions returns an empty version router.
+func NewVersions(opts VersionOptions) *Versions {
+	v := &Versions{opts: opts, pool: &sync.Pool{}}
+	v.pool.New = func() interface{} {
+		return NewRouteContext()
+	}
+	return v
+}
+
+// Version routes requests for version `name`, e.g. "2", to `handler`. It
+// panics on duplicate versions.
+func (v *Versions) Version(name string, handler Handler) *APIVersion {
+	if handler == nil {
+		panic(fmt.Sprintf("orbit: attempting to route a nil handler on version '%s'", name))
+	}
+	name = strings.TrimPrefix(name, "v")
+	if v.lookup(name) != nil {
+		panic(fmt.Sprintf("orbit: version '%s' is already registered", name))
+	}
+	av := &APIVersion{name: name, handler: handler}
+	v.versions = append(v.versions, av)
+	return av
+}
+
+// Name returns the name of the version, without "v" prefix.
+func (av *APIVersion) Name() string {
+	return av.name
+}
+
+// Deprecate flags the version as deprecated since `at`.
+func (av *APIVersion) Deprecate(at time.Time) *APIVersion {
+	av.deprecated = at
+	return av
+}
+
+// Sunset announces that the version stops being served at `at`. `link`,
+// if not empty, points to the migration docs.
+func (av *APIVersion) Sunset(at time.Time, link string) *APIVersion {
+	av.sunset = at
+	av.link = link
+	return av
+}
+
+// Launch starts the server like Orbit.Launch, once the routers of the
+// versions are frozen.
+func (v *Versions) Launch(address string) error {
+	v.checkDefault()
+	v.Freeze()
+	return launch(address, v)
+}
+
+// checkDefault panics if the Default version isn't registered, which would
+// make every request that doesn't ask for a version a 404. It is checked
+// once the router is mounted or launched.
+func (v *Versions) checkDefault() {
+	if v.opts.Default != "" && v.defaultVersion() == nil {
+		panic(fmt.Sprintf("orbit: default version '%s' is not registered", v.opts.Default))
+	}
+}
+
+// ServeHTTP dispatches the request to the router of the version it asks
+// for, or of the one it falls back to.
+func (v *Versions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rctx, _ := r.Context().Value(RouteCtxKey).(*Context)
+	if rctx == nil {
+		rctx = v.pool.Get().(*Context)
+		rctx.Reset()
+		var rc *requestContext
+		r, rc = withRouteContext(r, rctx)
+		defer v.pool.Put(rctx)
+		defer rc.release()
+	}
+
+	path := rctx.RoutePath
+	if path == "" {
+		path = r.URL.RawPath
+		if path == "" {
+			path = r.URL.Path
+		}
+	}
+
+	av, rest, code := v.resolve(r, path)
+	if code != 0 {
+		Error(w, r, NewHTTPError(code, "unsupported API version"))
+		return
+	}
+	if av == nil {
+		// Answered like the routes of the router Versions is mounted on.
+		if o, ok := rctx.Routes.(interface{ NotFoundHandler() HandlerFunc }); ok {
+			o.NotFoundHandler().ServeHTTP(w, r)
+			return
+		}
+		Error(w, r, errNotFound())
+		return
+	}
+
+	hdr := w.Header()
+	if v.opts.Header != "" {
+		hdr.Add("Vary", v.opts.Header)
+	}
+	if v.opts.MediaType != "" {
+		hdr.Add("Vary", "Accept")
+	}
+	if !av.deprecated.IsZero() {
+		hdr.Set("Deprecation", "@"+strconv.FormatInt(av.deprecated.Unix(), 10))
+	}
+	if !av.sunset.IsZero() {
+		hdr.Set("Sunset", av.sunset.UTC().Format(http.TimeFormat))
+		if av.link != "" {
+			hdr.Add("Link", fmt.Sprintf(`<%s>; rel="sunset"`, av.link))
+		}
+	}
+
+	h := v.fallback(av, r.Method, rest)
+	rctx.RoutePath = rest
+	if routes, ok := h.(Routes); ok {
+		rctx.Routes = routes
+	}
+	h.ServeHTTP(w, r)
+}
+
+// resolve returns the version requested and the path left to route. It
+// returns a status code if the request asks for an unknown version. A nil
+// request asks for the default version.
+func (v *Versions) resolve(r *http.Request, path string) (*APIVersion, string, int) {
+	if av, rest := v.pathVersion(path); av != nil {
+		return av, rest, 0
+	}
+	if r == nil {
+		return v.defaultVersion(), path, 0
+	}
+
+	if v.opts.Header != "" {
+		if name := strings.TrimSpace(r.Header.Get(v.opts.Header)); name != "" {
+			av := v.lookup(strings.TrimPrefix(name, "v"))
+			if av == nil {
+				return nil, path, http.StatusBadRequest
+			}
+			return av, path, 0
+		}
+	}
+
+	if v.opts.MediaType != "" {
+		prefix := "application/" + strings.ToLower(v.opts.MediaType) + ".v"
+		asked := false
+		for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+			mt, _, err := mime.ParseMediaType(accept)
+			if err != nil || !strings.HasPrefix(mt, prefix) {
+				continue
+			}
+			asked = true
+			name := mt[len(prefix):]
+			if i := strings.IndexByte(name, '+'); i >= 0 {
+				name = name[:i]
+			}
+			if av := v.lookup(name); av != nil {
+				return av, path, 0
+			}
+		}
+		if asked {
+			return nil, path, http.StatusNotAcceptable
+		}
+	}
+
+	return v.defaultVersion(), path, 0
+}
+
+// pathVersion returns the version named by the "/v{name}" prefix of
+// `path` and the rest of the path, if path versioning is enabled.
+func (v *Versions) pathVersion(path string) (*APIVersion, string) {
+	if !v.opts.Path || !strings.HasPrefix(path, "/v") {
+		return nil, path
+	}
+	seg := path[2:]
+	rest := "/"
+	if i := strings.IndexByte(seg, '/'); i >= 0 {
+		seg, rest = seg[:i], seg[i:]
+	}
+	if av := v.lookup(seg); av != nil {
+		return av, rest
+	}
+	return nil, path
+}
+
+func (v *Versions) lookup(name string) *APIVersion {
+	for _, av := range v.versions {
+		if av.name == name {
+			return av
+		}
+	}
+	return nil
+}
+
+func (v *Versions) defaultVersion() *APIVersion {
+	if v.opts.Default != "" {
+		return v.lookup(strings.TrimPrefix(v.opts.Default, "v"))
+	}
+	if len(v.versions) == 0 {
+		return nil
+	}
+	return v.versions[len(v.versions)-1]
+}
+
+// fallback returns the handler serving `method` and `path` for version
+// `av`: its own, or the one of the most recent previous version that
+// implements the route when Fallback is enabled.
+func (v *Versions) fallback(av *APIVersion, method, path string) Handler {
+	if !v.opts.Fallback {
+		return av.handler
+	}
+	i := len(v.versions) - 1
+	for v.versions[i] != av {
+		i--
+	}
+	for ; i >= 0; i-- {
+		routes, ok := v.versions[i].handler.(Routes)
+		if !ok {
+			return v.versions[i].handler
+		}
+		rctx := v.pool.Get().(*Context)
+		rctx.Reset()
+		found := routes.Match(rctx, method, path)
+		v.pool.Put(rctx)
+		if found {
+			return v.versions[i].handler
+		}
+	}
+	return av.handler
+}
+
+// Routes returns the routes of every version, each with the versions it
+// serves, fallbacks included. With path versioning, routes are reported
+// under the prefix of the version implementing them.
+func (v *Versions) Routes() []Route {
+	type key struct{ method, pattern string }
+
+	infos := make([][]RouteInfo, len(v.versions))
+	impl := make([]map[key]bool, len(v.versions))
+	for i, av := range v.versions {
+		if routes, ok := av.handler.(Routes); ok {
+			impl[i] = map[key]bool{}
+			WalkRoutes(routes, func(ri RouteInfo) error {
+				infos[i] = append(infos[i], ri)
+				impl[i][key{ri.Method, ri.Route}] = true
+				return nil
+			})
+		}
+	}
+
+	var routes []Route
+	for i, av := range v.versions {
+		prefix := ""
+		if v.opts.Path {
+			prefix = "/v" + av.name
+		}
+		if impl[i] == nil {
+			rt := Route{Pattern: prefix + "/*", Handlers: map[string]Handler{"*": av.handler}, Versions: []string{av.name}}
+			for m := range methodMap {
+				rt.Handlers[m] = av.handler
+			}
+			routes = append(routes, rt)
+			continue
+		}
+
+		// Group the methods of a pattern served by the same versions.
+		index := map[string]int{}
+		for _, ri := range infos[i] {
+			served := []string{av.name}
+			for j := i + 1; v.opts.Fallback && j < len(v.versions); j++ {
+				if impl[j] == nil || impl[j][key{ri.Method, ri.Route}] {
+					break
+				}
+				served = append(served, v.versions[j].name)
+			}
+
+			id := ri.Route + " " + strings.Join(served, ",")
+			k, ok := index[id]
+			if !ok {
+				k = len(routes)
+				index[id] = k
+				routes = append(routes, Route{
+					Pattern: prefix + ri.Route, Host: ri.Host, Versions: served,
+					Handlers: map[string]Handler{}, Meta: map[string]*RouteMeta{},
+				})
+			}
+			// Report the middlewares without building their chain again.
+			routes[k].Handlers[ri.Method] = &ChainHandler{
+				Endpoint: ri.Handler, Middlewares: ri.Middlewares,
+				chain: ri.handler, policies: ri.Policies[:len(ri.Policies)-len(ri.Meta.policies())],
+			}
+			routes[k].Meta[ri.Method] = ri.Meta
+		}
+	}
+	return routes
+}
+
+// Middlewares returns nil, version routers have no middleware stack.
+func (v *Versions) Middlewares() Middlewares {
+	return nil
+}
+
+// Match reports whether the version ServeHTTP would pick matches the
+// method/path. Without a request to read headers from, that is the
+// version named by the path prefix, or else the default version.
+func (v *Versions) Match(rctx *Context, method, path string) bool {
+	av, rest, code := v.resolve(rctx.matchRequest, path)
+	if code != 0 || av == nil {
+		return false
+	}
+	routes, ok := v.fallback(av, method, rest).(Routes)
+	return !ok || routes.Match(rctx, method, rest)
+}
@@ -0,0 +1,50 @@
+package orbit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionsUnknownDefault(t *testing.T) {
+	v := NewVersions(VersionOptions{Path: true, Default: "v3"})
+	v.Version("1", NewOrbit())
+
+	defer func() {
+		if recover() == nil {
+			t.Error("mounting versions with an unregistered default didn't panic")
+		}
+	}()
+	NewOrbit().Mount("/api", v)
+}
+
+// Match picks the version ServeHTTP would, headers included.
+func TestVersionsMatch(t *testing.T) {
+	v1, v2 := NewOrbit(), NewOrbit()
+	v1.Get("/old", func(b Bits) error { return nil })
+	v2.Get("/new", func(b Bits) error { return nil })
+	v := NewVersions(VersionOptions{Path: true, Header: "API-Version", Default: "1"})
+	v.Version("1", v1)
+	v.Version("2", v2)
+
+	for _, tt := range []struct {
+		path, header string
+		want         bool
+	}{
+		{"/v2/new", "", true},
+		{"/new", "", false},
+		{"/old", "", true},
+		{"/new", "2", true},
+		{"/old", "2", false},
+		{"/new", "9", false},
+	} {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set("API-Version", tt.header)
+		}
+		rctx := NewRouteContext()
+		rctx.matchRequest = r
+		if got := v.Match(rctx, "GET", tt.path); got != tt.want {
+			t.Errorf("Match(%s, API-Version: %q) = %v, want %v", tt.path, tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package orbit
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrConnClosed is returned when writing to a WebSocket connection that is
+// closing or closed.
+var ErrConnClosed = errors.New("orbit: websocket connection closed")
+
+// WebSocketFunc serves a WebSocket connection. The connection is closed
+// when it returns, with CloseInternalError if it returns an error.
+type WebSocketFunc func(b Bits, conn *Conn) error
+
+// WebSocketOption configures the WebSocket endpoints added with
+// Orbit.WebSocket.
+type WebSocketOption func(c *wsConfig)
+
+type wsConfig struct {
+	checkOrigin  func(r *http.Request) bool
+	subprotocols []string
+	readLimit    int64
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// WebSocketOrigins allows cross-origin handshakes from the origins
+// matching `patterns`, like "https://app.example.com" or
+// "https://*.example.com", or from any origin with "*". By default, only
+// browsers on the same host as the request may connect.
+func WebSocketOrigins(patterns ...string) WebSocketOption {
+	return func(c *wsConfig) {
+		c.checkOrigin = func(r *http.Request) bool {
+			origin := strings.ToLower(r.Header.Get("Origin"))
+			if origin == "" {
+				return true
+			}
+			for _, p := range patterns {
+				if ok, _ := path.Match(strings.ToLower(p), origin); ok || p == "*" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
+// WebSocketCheckOrigin sets the function deciding whether to accept the
+// handshake, replacing the origin policy.
+func WebSocketCheckOrigin(fn func(r *http.Request) bool) WebSocketOption {
+	return func(c *wsConfig) { c.checkOrigin = fn }
+}
+
+// WebSocketSubprotocols sets the subprotocols supported by the endpoint.
+// The first one offered by the client that is supported is selected, see
+// Conn.Subprotocol.
+func WebSocketSubprotocols(protocols ...string) WebSocketOption {
+	return func(c *wsConfig) { c.subprotocols = protocols }
+}
+
+// WebSocketReadLimit sets the maximum size of a message read. Larger
+// messages close the connection with CloseMessageTooBig. The default is
+// 1 MiB, which 0 or less keeps: messages are always limited, as they are
+// read in memory.
+func WebSocketReadLimit(n int64) WebSocketOption {
+	return func(c *wsConfig) {
+		if n > 0 {
+			c.readLimit = n
+		}
+	}
+}
+
+// WebSocketKeepAlive sends a ping every `interval`, and drops connections
+// that send nothing, pongs included, for `timeout`. The default is a ping
+// every 30 seconds and a timeout of 60 seconds, 0 disables pings.
+func WebSocketKeepAlive(interval, timeout time.Duration) WebSocketOption {
+	return func(c *wsConfig) {
+		c.pingInterval = interval
+		c.pongTimeout = timeout
+	}
+}
+
+// WebSocket adds a GET route upgrading requests for `pattern` to WebSocket
+// connections served by `fn`, e.g.
+//
+//	o.WebSocket("/ws/{room}", func(b orbit.Bits, conn *orbit.Conn) error {
+//		for {
+//			typ, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return nil
+//			}
+//			if err := conn.WriteMessage(typ, msg); err != nil {
+//				return err
+//			}
+//		}
+//	})
+//
+// Middlewares run before the upgrade, so authentication can reject the
+// handshake with a regular response. Invalid handshakes get a 400, a 403
+// for disallowed origins or a 426 for unsupported versions.
+//
+// Open connections are closed with CloseGoingAway when the server they are
+// served by shuts down, e.g. by Launch.
+func (o *Orbit) WebSocket(pattern string, fn WebSocketFunc, opts ...WebSocketOption) *RouteHandle {
+	cfg := wsConfig{
+		checkOrigin:  sameOrigin,
+		readLimit:    1 << 20,
+		pingInterval: 30 * time.Second,
+		pongTimeout:  60 * time.Second,
+		writeTimeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return o.Get(pattern, func(b Bits) error {
+		conn, err := upgrade(b.Response(), b.Request(), &cfg)
+		if conn == nil {
+			return err
+		}
+		// The response is gone, errors can only end the connection.
+		conn.finish(fn(b, conn))
+		return nil
+	})
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// MessageType is the type of a WebSocket message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// CloseCode is the status code of a WebSocket close frame.
+type CloseCode int
+
+const (
+	CloseNormal          CloseCode = 1000
+	CloseGoingAway       CloseCode = 1001
+	CloseProtocolError   CloseCode = 1002
+	CloseUnsupportedData CloseCode = 1003
+	CloseNoStatus        CloseCode = 1005
+	CloseInvalidPayload  CloseCode = 1007
+	ClosePolicyViolation CloseCode = 1008
+	CloseMessageTooBig   CloseCode = 1009
+	CloseInternalError   CloseCode = 1011
+)
+
+// CloseError is returned by Conn.ReadMessage once the connection is
+// closed, with the code and reason of the close frame.
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("orbit: websocket closed with %d", e.Code)
+	}
+	return fmt.Sprintf("orbit: websocket closed with %d: %s", e.Code, e.Reason)
+}
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// closeTimeout bounds the wait for the close frame of the client once the
+// server sent its own.
+const closeTimeout = 5 * time.Second
+
+// Conn is a WebSocket connection. Messages can be written from several
+// goroutines, but only one may read at a time. Pings, pongs and close
+// frames from the client are handled while reading, so keep reading for
+// the connection to stay alive.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	cfg         *wsConfig
+	subprotocol string
+
+	wmu       sync.Mutex
+	closeSent bool
+
+	readErr       error
+	closeReceived bool
+
+	stop     chan struct{}
+	done     chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+// Subprotocol returns the subprotocol selected during the handshake.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the network address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage reads the next message. It returns a *CloseError once the
+// client closed the connection, or answered a Close.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	var typ MessageType
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil && err != ErrConnClosed {
+				return 0, nil, c.fail(err)
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.fail(c.closeFrame(payload))
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unfinished fragmented message"})
+			}
+			typ = MessageType(op)
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unknown opcode"})
+		}
+
+		msg = append(msg, payload...)
+		if fin {
+			break
+		}
+	}
+
+	if typ == TextMessage && !utf8.Valid(msg) {
+		return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"})
+	}
+	return typ, msg, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into `v`.
+func (c *Conn) ReadJSON(v any) error {
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, v)
+}
+
+// WriteMessage writes a message.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("orbit: invalid websocket message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// WriteJSON writes `v` encoded as JSON in a text message.
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, data)
+}
+
+// Close starts the closing handshake with `code` and `reason`. Nothing can
+// be written afterwards, and ReadMessage returns a *CloseError once the
+// client answers.
+func (c *Conn) Close(code CloseCode, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	err := c.writeFrame(opClose, payload)
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	}
+	return err
+}
+
+// readFrame reads a frame, checking it against the protocol and the read
+// limit, with `size` bytes of the message already read.
+func (c *Conn) readFrame(size int64) (fin bool, op byte, payload []byte, err error) {
+	if c.cfg.pongTimeout > 0 && !c.closing() {
+		c.conn.SetReadDeadline(time.Now().Add(c.cfg.pongTimeout))
+	}
+
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.br, hdr[:]); err != nil {
+		return
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0f
+	if hdr[0]&0x70 != 0 {
+		err = &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+		return
+	}
+	if hdr[1]&0x80 == 0 {
+		err = &CloseError{Code: CloseProtocolError, Reason: "unmasked client frame"}
+		return
+	}
+
+	n := int64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		if ext[0]&0x80 != 0 {
+			err = &CloseError{Code: CloseProtocolError, Reason: "invalid payload length"}
+			return
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if op&0x8 != 0 {
+		if !fin || n > 125 {
+			err = &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+			return
+		}
+	} else if size+n > c.cfg.readLimit {
+		err = &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+// closeFrame answers the close frame of the client, and returns the
+// matching *CloseError.
+func (c *Conn) closeFrame(payload []byte) error {
+	c.closeReceived = true
+	ce := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		ce = &CloseError{Code: CloseProtocolError, Reason: "invalid close frame"}
+	case len(payload) >= 2:
+		ce.Code = CloseCode(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+		if !validCloseCode(ce.Code) || !utf8.ValidString(ce.Reason) {
+			ce = &CloseError{Code: CloseProtocolError, Reason: "invalid close frame"}
+		}
+	}
+
+	if ce.Code == CloseNoStatus {
+		c.writeFrame(opClose, nil)
+	} else {
+		c.Close(ce.Code, "")
+	}
+	return ce
+}
+
+func validCloseCode(code CloseCode) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1011:
+		return code != 1004 && code != CloseNoStatus && code != 1006
+	}
+	return false
+}
+
+// fail records `err` as the outcome of every later read. Protocol errors
+// close the connection with their code.
+func (c *Conn) fail(err error) error {
+	var ce *CloseError
+	if errors.As(err, &ce) && !c.closeReceived {
+		c.Close(ce.Code, ce.Reason)
+	}
+	c.readErr = err
+	return err
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrConnClosed
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+
+	if c.cfg.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.cfg.writeTimeout))
+	}
+	bufs := net.Buffers{hdr, payload}
+	_, err := bufs.WriteTo(c.conn)
+	return err
+}
+
+func (c *Conn) closing() bool {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.closeSent
+}
+
+func (c *Conn) keepAlive() {
+	defer close(c.done)
+	t := time.NewTicker(c.cfg.pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if c.writeFrame(opPing, nil) != nil {
+				return
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// finish ends the connection once the handler returned `err`, completing
+// the closing handshake unless the client is already gone.
+func (c *Conn) finish(err error) {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+
+		var ce *CloseError
+		switch {
+		case err == nil, errors.As(err, &ce):
+			c.Close(CloseNormal, "")
+		default:
+			c.Close(CloseInternalError, "")
+		}
+
+		// Wait for the close frame of the client, if it wasn't read yet.
+		if c.readErr == nil {
+			c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+			for {
+				if _, _, err := c.ReadMessage(); err != nil {
+					break
+				}
+			}
+		}
+		c.conn.Close()
+		close(c.finished)
+	})
+}
+
+// upgrade validates the handshake of `r` and takes the connection over
+// from the server. It returns neither a connection nor an error if the
+// connection was lost during the handshake.
+func upgrade(w http.ResponseWriter, r *http.Request, cfg *wsConfig) (*Conn, error) {
+	if !r.ProtoAtLeast(1, 1) ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, NewHTTPError(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		e := NewHTTPError(http.StatusUpgradeRequired, "unsupported websocket version")
+		e.Header = http.Header{"Sec-WebSocket-Version": {"13"}}
+		return nil, e
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return nil, NewHTTPError(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if cfg.checkOrigin != nil && !cfg.checkOrigin(r) {
+		return nil, NewHTTPError(http.StatusForbidden, "origin not allowed")
+	}
+
+	var subprotocol string
+offered:
+	for _, p := range headerTokens(r.Header, "Sec-WebSocket-Protocol") {
+		for _, sp := range cfg.subprotocols {
+			if p == sp {
+				subprotocol = sp
+				break offered
+			}
+		}
+	}
+
+	// Get the registry while the server still waits for the request.
+	reg := serving(r)
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("orbit: websocket upgrade: %w", err)
+	}
+	// Drop the deadlines of the server, they were meant for requests.
+	netConn.SetDeadline(time.Time{})
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	// Keep the headers set by middlewares, e.g. cookies.
+	for k, vs := range w.Header() {
+		switch k {
+		case "Content-Type", "Content-Length", "Transfer-Encoding", "Upgrade", "Connection":
+			continue
+		}
+		for _, v := range vs {
+			sb.WriteString(k + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(v) + "\r\n")
+		}
+	}
+	sb.WriteString("\r\n")
+
+	netConn.SetWriteDeadline(time.Now().Add(cfg.writeTimeout))
+	if _, err := io.WriteString(netConn, sb.String()); err != nil {
+		netConn.Close()
+		return nil, nil
+	}
+
+	c := &Conn{
+		conn:        netConn,
+		br:          brw.Reader,
+		cfg:         cfg,
+		subprotocol: subprotocol,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+	if cfg.pingInterval > 0 {
+		go c.keepAlive()
+	} else {
+		close(c.done)
+	}
+	if reg != nil {
+		reg.track(c)
+	}
+	return c, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+"258EAFA5-E914-47DA-95CA-C5AB0DC85B11")
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerTokens returns the comma separated tokens of the `name` headers.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
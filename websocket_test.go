@@ -0,0 +1,423 @@
+package orbit
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// wsClient is the client side of a WebSocket connection, writing masked
+// frames and reading the frames of the server.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	resp *http.Response
+}
+
+// dialWS sends a handshake for `path` to `srv`, with `header` on top of a
+// valid one.
+func dialWS(t *testing.T, srv *httptest.Server, path string, header http.Header) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	r, _ := http.NewRequest("GET", srv.URL+path, nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, vs := range header {
+		r.Header[k] = vs
+	}
+	if err := r.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &wsClient{t: t, conn: conn, br: bufio.NewReader(conn)}
+	if c.resp, err = http.ReadResponse(c.br, r); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+// writeFrame writes a masked frame.
+func (c *wsClient) writeFrame(fin bool, op byte, payload []byte) {
+	c.t.Helper()
+	b := []byte{op, 0x80}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b[1] |= byte(n)
+	case n <= 0xffff:
+		b[1] |= 126
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b[1] |= 127
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	b = append(b, mask[:]...)
+	for i, p := range payload {
+		b = append(b, p^mask[i&3])
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame reads an unmasked frame of the server.
+func (c *wsClient) readFrame() (op byte, payload []byte) {
+	c.t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+// expectClose reads frames until a close frame and checks its code.
+func (c *wsClient) expectClose(code CloseCode) {
+	c.t.Helper()
+	for {
+		op, payload := c.readFrame()
+		if op != opClose {
+			continue
+		}
+		if len(payload) < 2 || CloseCode(binary.BigEndian.Uint16(payload)) != code {
+			c.t.Fatalf("close frame %v, want code %d", payload, code)
+		}
+		return
+	}
+}
+
+func closePayload(code CloseCode) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
+
+// newEchoServer serves an echo WebSocket endpoint on /ws. The outcome of
+// the handler is sent on the returned channel.
+func newEchoServer(t *testing.T, opts ...WebSocketOption) (*httptest.Server, chan error) {
+	done := make(chan error, 1)
+	o := NewOrbit()
+	opts = append([]WebSocketOption{WebSocketKeepAlive(0, 0), WebSocketSubprotocols("chat.v2", "chat.v1")}, opts...)
+	o.WebSocket("/ws", func(b Bits, conn *Conn) error {
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				done <- err
+				return nil
+			}
+			if err := conn.WriteMessage(typ, msg); err != nil {
+				done <- err
+				return err
+			}
+		}
+	}, opts...)
+	srv := httptest.NewServer(o)
+	t.Cleanup(srv.Close)
+	return srv, done
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	o := NewOrbit()
+	o.WebSocket("/ws", func(b Bits, conn *Conn) error { return nil })
+
+	valid := func(mod func(r *http.Request)) *http.Request {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		mod(r)
+		return r
+	}
+	tests := []struct {
+		name string
+		r    *http.Request
+		code int
+	}{
+		{"NoUpgrade", valid(func(r *http.Request) { r.Header.Del("Upgrade") }), http.StatusBadRequest},
+		{"NoConnection", valid(func(r *http.Request) { r.Header.Set("Connection", "close") }), http.StatusBadRequest},
+		{"HTTP10", valid(func(r *http.Request) { r.ProtoMinor = 0 }), http.StatusBadRequest},
+		{"Version", valid(func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }), http.StatusUpgradeRequired},
+		{"ShortKey", valid(func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") }), http.StatusBadRequest},
+		{"NoKey", valid(func(r *http.Request) { r.Header.Del("Sec-WebSocket-Key") }), http.StatusBadRequest},
+		{"CrossOrigin", valid(func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") }), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			o.ServeHTTP(w, tt.r)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d", w.Code, tt.code)
+			}
+			if tt.code == http.StatusUpgradeRequired && w.Header().Get("Sec-WebSocket-Version") != "13" {
+				t.Errorf("Sec-WebSocket-Version = %q, want 13", w.Header().Get("Sec-WebSocket-Version"))
+			}
+		})
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv, _ := newEchoServer(t)
+	c := dialWS(t, srv, "/ws", http.Header{"Sec-Websocket-Protocol": {"chat.v3, chat.v1", "chat.v2"}})
+
+	if c.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", c.resp.StatusCode)
+	}
+	// The example of RFC 6455, section 1.3.
+	if got := c.resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+	// The first offered protocol that is supported wins.
+	if got := c.resp.Header.Get("Sec-WebSocket-Protocol"); got != "chat.v1" {
+		t.Errorf("Sec-WebSocket-Protocol = %q, want chat.v1", got)
+	}
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	srv, done := newEchoServer(t)
+	c := dialWS(t, srv, "/ws", nil)
+
+	c.writeFrame(true, opText, []byte("hello"))
+	if op, msg := c.readFrame(); op != opText || string(msg) != "hello" {
+		t.Errorf("echo = %x %q", op, msg)
+	}
+
+	// A ping between the fragments of a message is answered right away.
+	c.writeFrame(false, opBinary, []byte("frag"))
+	c.writeFrame(true, opPing, []byte("p1"))
+	c.writeFrame(true, opContinuation, []byte("ment"))
+	if op, msg := c.readFrame(); op != opPong || string(msg) != "p1" {
+		t.Errorf("pong = %x %q", op, msg)
+	}
+	if op, msg := c.readFrame(); op != opBinary || string(msg) != "fragment" {
+		t.Errorf("echo = %x %q", op, msg)
+	}
+
+	// The close handshake: the server answers with the same code.
+	c.writeFrame(true, opClose, append(closePayload(CloseNormal), "bye"...))
+	c.expectClose(CloseNormal)
+	var ce *CloseError
+	if err := <-done; !errors.As(err, &ce) || ce.Code != CloseNormal || ce.Reason != "bye" {
+		t.Errorf("ReadMessage() = %v, want a CloseError 1000 bye", err)
+	}
+	// Then the server closes the TCP connection.
+	if _, err := c.br.ReadByte(); err != io.EOF {
+		t.Errorf("read after close = %v, want EOF", err)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(c *wsClient)
+		code  CloseCode
+	}{
+		{"TooBig", func(c *wsClient) { c.writeFrame(true, opBinary, make([]byte, 65)) }, CloseMessageTooBig},
+		{"TooBigFragments", func(c *wsClient) {
+			c.writeFrame(false, opBinary, make([]byte, 40))
+			c.writeFrame(true, opContinuation, make([]byte, 40))
+		}, CloseMessageTooBig},
+		// A 2^62 bytes frame must be refused before being read.
+		{"HugeLength", func(c *wsClient) {
+			c.conn.Write([]byte{0x82, 0x80 | 127, 0x40, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4})
+		}, CloseMessageTooBig},
+		{"LongPing", func(c *wsClient) { c.writeFrame(true, opPing, make([]byte, 126)) }, CloseProtocolError},
+		{"FragmentedPing", func(c *wsClient) { c.writeFrame(false, opPing, nil) }, CloseProtocolError},
+		{"Continuation", func(c *wsClient) { c.writeFrame(true, opContinuation, []byte("x")) }, CloseProtocolError},
+		{"UnknownOpcode", func(c *wsClient) { c.writeFrame(true, 0x3, nil) }, CloseProtocolError},
+		{"Unmasked", func(c *wsClient) { c.conn.Write([]byte{0x81, 0x01, 'x'}) }, CloseProtocolError},
+		{"InvalidUTF8", func(c *wsClient) { c.writeFrame(true, opText, []byte{0xff, 0xfe}) }, CloseInvalidPayload},
+		{"InvalidCloseCode", func(c *wsClient) { c.writeFrame(true, opClose, closePayload(1005)) }, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newEchoServer(t, WebSocketReadLimit(64))
+			c := dialWS(t, srv, "/ws", nil)
+			tt.write(c)
+			c.expectClose(tt.code)
+		})
+	}
+}
+
+// hijackRecorder is a ResponseRecorder that can be hijacked.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return c1, bufio.NewReadWriter(bufio.NewReader(c1), bufio.NewWriter(c1)), nil
+}
+
+// The response writers wrapped by middlewares keep the connection
+// hijackable, so WebSocket routes work behind them.
+func TestWrappedWritersHijack(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(w http.ResponseWriter) http.ResponseWriter
+	}{
+		{"sessionWriter", func(w http.ResponseWriter) http.ResponseWriter {
+			return &sessionWriter{ResponseWriter: w, commit: func() error { return nil }}
+		}},
+		{"headWriter", func(w http.ResponseWriter) http.ResponseWriter { return &headWriter{ResponseWriter: w} }},
+		{"recordingWriter", func(w http.ResponseWriter) http.ResponseWriter {
+			return &recordingWriter{ResponseWriter: w, limit: 1 << 20}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+			conn, _, err := http.NewResponseController(tt.wrap(hr)).Hijack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+			if !hr.hijacked {
+				t.Error("the wrapped writer wasn't hijacked")
+			}
+		})
+	}
+}
+
+// A WebSocket route behind the Session middleware upgrades.
+func TestWebSocketBehindSession(t *testing.T) {
+	o := NewOrbit()
+	o.Use(Session(SessionOptions{Store: NewMemoryStore()}))
+	o.WebSocket("/ws", func(b Bits, conn *Conn) error {
+		conn.ReadMessage()
+		return nil
+	}, WebSocketKeepAlive(0, 0))
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	c := dialWS(t, srv, "/ws", nil)
+	if c.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", c.resp.StatusCode)
+	}
+	c.writeFrame(true, opClose, closePayload(CloseNormal))
+	c.expectClose(CloseNormal)
+}
+
+// A handshake still being served when the server shuts down gets a
+// connection closed with 1001, which Shutdown doesn't wait on.
+func TestWebSocketHandshakeDuringShutdown(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	o := NewOrbit()
+	o.With(func(next Handler) Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+			next.ServeHTTP(w, r)
+		})
+	}).WebSocket("/ws", func(b Bits, conn *Conn) error {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return nil
+			}
+		}
+	}, WebSocketKeepAlive(0, 0))
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+	reg := registry(srv.Config)
+	defer reg.forget()
+
+	resp := make(chan *wsClient, 1)
+	go func() { resp <- dialWS(t, srv, "/ws", nil) }()
+	<-entered
+
+	shut := make(chan error, 1)
+	go func() { shut <- srv.Config.Shutdown(context.Background()) }()
+	for !registryClosed(reg) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	c := <-resp
+	if c.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", c.resp.StatusCode)
+	}
+	c.expectClose(CloseGoingAway)
+	c.writeFrame(true, opClose, closePayload(CloseGoingAway))
+	if err := <-shut; err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := reg.wait(ctx); err != nil {
+		t.Errorf("wait() = %v", err)
+	}
+}
+
+// Event streams end when the server shuts down, rather than holding it up
+// until its deadline.
+func TestSSEShutdown(t *testing.T) {
+	opened := make(chan struct{})
+	o := NewOrbit()
+	o.Get("/events", func(b Bits) error {
+		s, err := b.SSE(SSEHeartbeat(0))
+		if err != nil {
+			return err
+		}
+		close(opened)
+		<-s.Done()
+		return nil
+	})
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+	defer registry(srv.Config).forget()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	<-opened
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+}
+
+func registryClosed(reg *serverRegistry) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.closed
+}